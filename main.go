@@ -2,31 +2,107 @@ package main
 
 import (
 	"flag"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gadumitrachioaiei/gamescore/service"
 )
 
-var address = flag.String("address", "", "Address for the api")
+var (
+	address          = flag.String("address", "", "Address for the api")
+	dataDir          = flag.String("data-dir", "", "Directory where scores are persisted, if empty they are kept only in memory")
+	snapshotInterval = flag.Duration("snapshot-interval", time.Minute, "How often persisted scores are snapshotted")
+	sweepInterval    = flag.Duration("sweep-interval", time.Minute, "How often expired scores are removed from memory")
+	timeout          = flag.Duration("timeout", time.Second, "How long a request can take, except imports and exports")
+	transferTimeout  = flag.Duration("transfer-timeout", time.Hour, "How long an import or an export of a board can take")
+	respAddress      = flag.String("resp-address", "", "Address for the redis protocol, serving boards as sorted sets, if empty it is not served")
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importScores(os.Args[2:])
+		return
+	}
 	flag.Parse()
 	if *address == "" {
 		log.Fatal("Missing address parameter, see help")
 	}
-	mux := http.NewServeMux()
-	mux.Handle("/scores/", service.New())
-	s := http.Server{
-		Addr:              *address,
-		Handler:           mux,
-		ReadTimeout:       time.Second,
-		ReadHeaderTimeout: time.Second,
-		WriteTimeout:      time.Second,
-		IdleTimeout:       time.Second,
+	var svc *service.Service
+	if *dataDir == "" {
+		svc = service.New(nil)
+	} else {
+		var err error
+		if svc, err = service.Open(*dataDir); err != nil {
+			log.Fatalf("cannot open data directory: %v", err)
+		}
+		go svc.Snapshot(*snapshotInterval)
+	}
+	defer svc.Close()
+	go svc.Sweep(*sweepInterval)
+	if *respAddress != "" {
+		l, err := net.Listen("tcp", *respAddress)
+		if err != nil {
+			log.Fatalf("cannot listen for the redis protocol: %v", err)
+		}
+		go func() {
+			if err := svc.ServeRESP(l); err != nil {
+				log.Printf("cannot serve the redis protocol: %v", err)
+			}
+		}()
 	}
+	s := svc.Server(*address, *timeout, *transferTimeout)
 	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("cannot start service: %v", err)
 	}
 }
+
+// importScores loads the scores of a file, sorted from best to worst, into an empty persisted board.
+//
+// The service must not be running on the same data directory.
+func importScores(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dir := flags.String("data-dir", "", "Directory where scores are persisted")
+	board := flags.String("board", service.DefaultBoard, "Board that gets the scores")
+	format := flags.String("format", "", "Format of the scores, csv or ndjson, by default given by the file extension")
+	flags.Usage = func() {
+		flags.Output().Write([]byte("Usage: gamescore import [flags] [file]\n\nReads the scores from the standard input if there is no file.\n\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *dir == "" {
+		log.Fatal("Missing data-dir parameter, see help")
+	}
+	var r io.Reader = os.Stdin
+	if file := flags.Arg(0); file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Fatalf("cannot open scores: %v", err)
+		}
+		defer f.Close()
+		r = f
+		if *format == "" {
+			*format = strings.TrimPrefix(filepath.Ext(file), ".")
+		}
+	}
+	next, err := service.ScoreReader(r, *format)
+	if err != nil {
+		log.Fatalf("cannot read scores: %v", err)
+	}
+	svc, err := service.Open(*dir)
+	if err != nil {
+		log.Fatalf("cannot open data directory: %v", err)
+	}
+	err = svc.Boards().Load(*board, next)
+	if closeErr := svc.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatalf("cannot import scores: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package scores
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BatchError is returned by ApplyBatch when some mutations of the batch are invalid, so none of them was applied.
+type BatchError struct {
+	Errors []error // errors of the mutations, by their index in the batch, nil for the valid ones
+}
+
+func (e *BatchError) Error() string {
+	var first, count int
+	for i, err := range e.Errors {
+		if err != nil {
+			if count == 0 {
+				first = i
+			}
+			count++
+		}
+	}
+	return fmt.Sprintf("%d invalid mutations in batch, the first one at %d: %v", count, first, e.Errors[first])
+}
+
+// ApplyBatch applies all mutations, in order, or none of them, returning the new scores of their users.
+//
+// The mutations are validated as if the previous ones in the batch were already applied,
+// and if any of them is invalid, it returns a *BatchError with the errors of all invalid ones.
+// The batch is applied under the lock of the scores and logged as a single record,
+// so readers and restarts see either all of its mutations or none of them.
+//
+// A mutation with an idempotency key which was already applied is skipped, and its result is the one returned then.
+func (s *Scores) ApplyBatch(mutations []Mutation) ([]VersionedScore, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	return s.applyBatch(mutations)
+}
+
+// AccumulateBatch adds the values of the mutations to the scores of their users, adding the users without a score,
+// as if every mutation was submitted with the Accumulate policy, and returns their new scores.
+//
+// The kinds and versions of the mutations are ignored. Like ApplyBatch, it applies all mutations or none of them,
+// and readers and restarts see either all of them or none of them.
+func (s *Scores) AccumulateBatch(mutations []Mutation) ([]VersionedScore, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.expire()
+	// users added by the previous mutations
+	added := make(map[int]bool)
+	accumulated := make([]Mutation, len(mutations))
+	for i, m := range mutations {
+		m.Kind, m.Version = MutationUpdate, 0
+		if _, ok := s.users[m.User]; !ok && !added[m.User] {
+			m.Kind = MutationAdd
+			added[m.User] = true
+		}
+		accumulated[i] = m
+	}
+	return s.applyBatch(accumulated)
+}
+
+// applyBatch applies the mutations as by ApplyBatch.
+//
+// The scores lock must be held for writing.
+func (s *Scores) applyBatch(mutations []Mutation) ([]VersionedScore, error) {
+	batch := record{op: opBatch, batch: make([]record, len(mutations))}
+	batchErr := &BatchError{Errors: make([]error, len(mutations))}
+	var invalid bool
+	for i, m := range mutations {
+		if batch.batch[i], batchErr.Errors[i] = m.record(); batchErr.Errors[i] != nil {
+			invalid = true
+		}
+	}
+	at := s.expire()
+	results := make([]VersionedScore, len(mutations))
+	applied := make([]bool, len(mutations))
+	if s.validateBatch(batch.batch, batchErr.Errors, results, applied) || invalid {
+		return nil, batchErr
+	}
+	var records []record
+	for i, r := range batch.batch {
+		if !applied[i] {
+			r.at = at
+			records = append(records, r)
+		}
+	}
+	batch.batch = records
+	if len(batch.batch) == 0 {
+		return results, nil
+	}
+	if err := s.journal(batch); err != nil {
+		return nil, err
+	}
+	for i, j := 0, 0; i < len(results); i++ {
+		if !applied[i] {
+			results[i] = s.commit(batch.batch[j])
+			j++
+		}
+	}
+	return results, nil
+}
+
+// validateBatch validates the mutations of a batch, each one as if the previous ones were already applied,
+// and stores their errors in errs. The results of mutations with keys which were already applied are stored in results,
+// marking them as applied.
+//
+// Returns whether any mutation is invalid.
+func (s *Scores) validateBatch(records []record, errs []error, results []VersionedScore, applied []bool) bool {
+	// users changed by the previous mutations, with the version they would have
+	type user struct {
+		exists  bool
+		version uint64
+	}
+	users := make(map[int]user)
+	keys := make(map[string]bool)
+	seq := s.seq
+	var invalid bool
+	for i, r := range records {
+		if errs[i] != nil {
+			continue
+		}
+		if score, ok, err := s.duplicate(r); err != nil || ok {
+			errs[i], results[i], applied[i] = err, score, ok
+			invalid = invalid || err != nil
+			continue
+		}
+		if r.key != "" && keys[r.key] {
+			errs[i], invalid = errors.New("repeated idempotency key in batch"), true
+			continue
+		}
+		u, ok := users[r.user]
+		if !ok {
+			node, exists := s.users[r.user]
+			u.exists = exists
+			if exists {
+				u.version = node.seq
+			}
+		}
+		if errs[i] = validateRecord(r, u.exists, u.version); errs[i] != nil {
+			invalid = true
+			continue
+		}
+		if r.key != "" {
+			keys[r.key] = true
+		}
+		switch {
+		case r.op == opAdd || r.op == opUpdate && r.value != 0:
+			seq++
+			u.exists, u.version = true, seq
+		case r.op == opRemove:
+			u.exists = false
+		}
+		users[r.user] = u
+	}
+	return invalid
+}
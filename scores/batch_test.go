@@ -0,0 +1,108 @@
+package scores
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestApplyBatch tests that a batch is applied entirely or not at all, and that it is replayed after reopening the scores.
+func TestApplyBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path, WithDedup(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Score{User: 1, Value: 10})
+	invalid := []Mutation{
+		{Kind: MutationUpdate, User: 1, Value: 5},
+		{Kind: MutationAdd, User: 1, Value: 5},
+		{Kind: MutationUpdate, User: 2, Value: 5},
+		{Kind: MutationAdd, User: 2, Value: 5},
+		{Kind: MutationUpdate, User: 1, Value: 5, Version: 1},
+	}
+	_, err = s.ApplyBatch(invalid)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("got error for invalid batch: %v, expected a batch error", err)
+	}
+	for i, expected := range []bool{false, true, true, false, true} {
+		if (batchErr.Errors[i] != nil) != expected {
+			t.Fatalf("got error for mutation %d: %v", i, batchErr.Errors[i])
+		}
+	}
+	if !errors.Is(batchErr.Errors[4], ErrVersionMismatch) {
+		t.Fatalf("got error for stale version: %v, expected: %v", batchErr.Errors[4], ErrVersionMismatch)
+	}
+	if calculated, expected := s.Top(10), []Score{{1, 10}}; !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores after invalid batch: %v, expected: %v", calculated, expected)
+	}
+	valid := []Mutation{
+		{Kind: MutationUpdate, User: 1, Value: 5, Version: 1, Key: "a"},
+		{Kind: MutationAdd, User: 2, Value: 5},
+		{Kind: MutationUpdate, User: 2, Value: 20, Version: 3},
+		{Kind: MutationAdd, User: 3, Value: 1},
+		{Kind: MutationRemove, User: 3},
+	}
+	results, err := s.ApplyBatch(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []VersionedScore{{Score{1, 15}, 2}, {Score{2, 5}, 3}, {Score{2, 25}, 4}, {Score{3, 1}, 5}, {Score{3, 0}, 0}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("got batch results: %v, expected: %v", results, expected)
+	}
+	// the mutation with a key which was applied is skipped
+	results, err = s.ApplyBatch([]Mutation{valid[0], {Kind: MutationUpdate, User: 2, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0] != expected[0] || results[1].Value != 26 {
+		t.Fatalf("got batch results: %v", results)
+	}
+	top := s.Top(10)
+	s.Close()
+	s, err = Open(path, WithDedup(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if calculated := s.Top(10); !reflect.DeepEqual(calculated, top) {
+		t.Fatalf("got replayed scores: %v, expected: %v", calculated, top)
+	}
+}
+
+// TestAccumulateBatch tests that a batch of accumulated scores is applied as the submissions of the scores one by one,
+// and that mutations already applied with the same keys are skipped.
+func TestAccumulateBatch(t *testing.T) {
+	batch, submitted := New(WithDedup(10)), New()
+	batch.Add(Score{User: 1, Value: 10})
+	submitted.Add(Score{User: 1, Value: 10})
+	mutations := []Mutation{
+		{Kind: MutationAdd, User: 1, Value: 5, Key: "a"},
+		{User: 2, Value: 3, Key: "b"},
+		{Kind: MutationRemove, User: 2, Value: 4, Version: 7},
+		{User: 3, Value: -2},
+	}
+	results, err := batch.AccumulateBatch(mutations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range mutations {
+		sub, _ := submitted.Submit(m.User, m.Value, Accumulate)
+		if results[i].Score != sub.Score {
+			t.Fatalf("got score %v of mutation %d, expected: %v", results[i].Score, i, sub.Score)
+		}
+	}
+	if calculated, expected := batch.Top(10), submitted.Top(10); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores: %v, expected: %v", calculated, expected)
+	}
+	if _, err := batch.AccumulateBatch([]Mutation{{User: 1, Value: 5, Key: "a"}, {User: 4, Value: 1, Key: "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	submitted.Submit(4, 1, Accumulate)
+	if calculated, expected := batch.Top(10), submitted.Top(10); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores after a repeated batch: %v, expected: %v", calculated, expected)
+	}
+}
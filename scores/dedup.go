@@ -0,0 +1,108 @@
+package scores
+
+import (
+	"fmt"
+)
+
+// MaxKeySize is the maximum size of an idempotency key, in bytes.
+const MaxKeySize = 256
+
+// WithDedup remembers the results of the last size mutations which had an idempotency key,
+// so repeating one of them returns its result instead of applying it again.
+//
+// The remembered results are persisted together with the scores.
+func WithDedup(size int) Option {
+	return func(s *Scores) {
+		if size > 0 {
+			s.dedup = &dedupTable{size: size, entries: make(map[string]dedupEntry)}
+		}
+	}
+}
+
+// AddIdempotent adds a new score for the user, as by AddWithReason.
+//
+// If a mutation with the same key was already applied, it does nothing. An empty key is no key.
+func (s *Scores) AddIdempotent(key string, score Score, reason string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	_, err := s.mutate(record{op: opAdd, user: score.User, value: score.Value, reason: reason, key: key})
+	return err
+}
+
+// UpdateIdempotent updates the score of an existing user, as by UpdateWithReason.
+//
+// If a mutation with the same key was already applied, it returns the score returned then. An empty key is no key.
+func (s *Scores) UpdateIdempotent(key string, score Score, reason string) (Score, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	v, err := s.mutate(record{op: opUpdate, user: score.User, value: score.Value, reason: reason, key: key})
+	return v.Score, err
+}
+
+// RemoveIdempotent removes the user and its score, as by Remove.
+//
+// If a mutation with the same key was already applied, it does nothing. An empty key is no key.
+func (s *Scores) RemoveIdempotent(key string, user int) error {
+	s.mu.Lock()
+	defer s.unlock()
+	_, err := s.mutate(record{op: opRemove, user: user, key: key})
+	return err
+}
+
+// duplicate returns the result of the mutation with the same key as r, if it was already applied.
+func (s *Scores) duplicate(r record) (VersionedScore, bool, error) {
+	if r.key == "" || s.dedup == nil {
+		return VersionedScore{}, false, nil
+	}
+	entry, ok := s.dedup.entries[r.key]
+	if !ok {
+		return VersionedScore{}, false, nil
+	}
+	if entry.score.User != r.user {
+		return VersionedScore{}, false, fmt.Errorf("idempotency key %q was used for user %d", r.key, entry.score.User)
+	}
+	return entry.score, true, nil
+}
+
+// dedupTable keeps the results of the last mutations with idempotency keys.
+//
+// The keys are kept in a ring, so the oldest one is forgotten when a new one comes.
+type dedupTable struct {
+	size    int
+	entries map[string]dedupEntry
+	ring    []string // keys, from the oldest one at next to the newest one before it
+	next    int
+}
+
+// dedupEntry is the result of a mutation with an idempotency key.
+type dedupEntry struct {
+	key   string
+	score VersionedScore
+}
+
+// add remembers the result of a mutation, if it had a key.
+func (t *dedupTable) add(key string, score VersionedScore) {
+	if t == nil || key == "" {
+		return
+	}
+	if len(t.ring) < t.size {
+		t.ring = append(t.ring, key)
+	} else {
+		delete(t.entries, t.ring[t.next])
+		t.ring[t.next] = key
+		t.next = (t.next + 1) % t.size
+	}
+	t.entries[key] = dedupEntry{key: key, score: score}
+}
+
+// list returns the remembered results, from the oldest to the newest.
+func (t *dedupTable) list() []dedupEntry {
+	if t == nil {
+		return nil
+	}
+	entries := make([]dedupEntry, 0, len(t.ring))
+	for i := range t.ring {
+		entries = append(entries, t.entries[t.ring[(t.next+i)%len(t.ring)]])
+	}
+	return entries
+}
@@ -0,0 +1,58 @@
+package scores
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDedup tests that mutations with the same idempotency key are applied once, also after reopening the scores,
+// and that only the last keys are remembered.
+func TestDedup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	open := func() *Scores {
+		s, err := Open(path, WithDedup(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	s := open()
+	s.AddIdempotent("a", Score{User: 1, Value: 10}, "")
+	s.AddIdempotent("b", Score{User: 2, Value: 10}, "")
+	if err := s.AddIdempotent("b", Score{User: 2, Value: 10}, ""); err != nil {
+		t.Fatalf("got error for repeated add: %v", err)
+	}
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		score, err := s.UpdateIdempotent("c", Score{User: 1, Value: 5}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := (Score{1, 15}); score != expected {
+			t.Fatalf("got updated score: %v, expected: %v", score, expected)
+		}
+		s.Close()
+		s = open()
+	}
+	defer s.Close()
+	if _, err := s.UpdateIdempotent("c", Score{User: 2, Value: 5}, ""); err == nil {
+		t.Fatalf("expected error for key used by another user")
+	}
+	sub, err := s.SubmitIdempotent("d", 2, 20, KeepLatest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repeated, err := s.SubmitIdempotent("d", 2, 20, Accumulate, ""); err != nil || repeated.Score != sub.Score || repeated.RankChanged() {
+		t.Fatalf("got repeated submission: %v %v, expected score: %v", repeated, err, sub.Score)
+	}
+	// the key "a" was forgotten, so its add is applied again
+	if err := s.AddIdempotent("a", Score{User: 1, Value: 10}, ""); err == nil {
+		t.Fatalf("expected error for existing user")
+	}
+	if calculated, expected := s.Top(10), []Score{{2, 20}, {1, 15}}; !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores: %v, expected: %v", calculated, expected)
+	}
+}
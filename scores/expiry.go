@@ -0,0 +1,132 @@
+package scores
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Scores that expire are kept in a min heap ordered by the time they were achieved at,
+// so the next score to expire is always at the top of the heap, and finding the expired scores
+// costs O(log n) for each of them, instead of a scan of the whole tree.
+//
+// Expired scores are removed before every operation, so they are never returned, even if nobody called Sweep.
+// Queries do not take the lock, unless the published version of the scores has a score which expired,
+// and then they take it to remove the expired scores.
+// The removals are not logged: every logged mutation has the time it happened at, and replaying it
+// first removes the scores that expired at that time, exactly as it happened before the restart.
+
+// WithExpiry makes the score of every user expire after ttl since it was achieved.
+//
+// Updates that do not change the score of the user, and submissions which do not replace it, do not postpone its expiry.
+func WithExpiry(ttl time.Duration) Option {
+	return func(s *Scores) {
+		s.ttl = ttl
+	}
+}
+
+// Sweep removes the expired scores, returning their number.
+//
+// Expired scores are never returned by the other methods, so this only frees their memory.
+func (s *Scores) Sweep() int {
+	s.mu.Lock()
+	defer s.unlock()
+	n := len(s.users)
+	s.expire()
+	return n - len(s.users)
+}
+
+// expire removes the scores which expired by now, and returns now as unix nanoseconds, to be logged with the next mutation.
+//
+// It returns 0 if the mutations do not need their time, because the scores neither expire nor keep history.
+func (s *Scores) expire() int64 {
+	if s.ttl <= 0 && s.history == nil {
+		return 0
+	}
+	now := s.now().UnixNano()
+	if s.ttl > 0 {
+		s.expireAt(now)
+	}
+	return now
+}
+
+// rlock locks the scores for reading, after removing the expired scores, if there are any.
+func (s *Scores) rlock() {
+	for {
+		s.mu.RLock()
+		if !s.expiring() {
+			return
+		}
+		s.mu.RUnlock()
+		s.mu.Lock()
+		s.expire()
+		s.unlock()
+	}
+}
+
+// expiring returns whether some scores expired by now.
+func (s *Scores) expiring() bool {
+	return s.ttl > 0 && len(s.expiry) > 0 && s.expiry[0].at <= s.now().UnixNano()-int64(s.ttl)
+}
+
+// expireAt removes the scores which expired by the time t, as unix nanoseconds.
+func (s *Scores) expireAt(t int64) {
+	deadline := t - int64(s.ttl)
+	for len(s.expiry) > 0 && s.expiry[0].at <= deadline {
+		node := s.expiry[0]
+		r := record{op: opRemove, user: node.user, at: node.at + int64(s.ttl), reason: "expired"}
+		s.apply(r)
+		s.remember(r, node.score, 0)
+	}
+}
+
+// expiryHeap is a min heap of nodes, ordered by the time they were achieved at.
+type expiryHeap []*Node
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	n := x.(*Node)
+	n.index = len(*h)
+	*h = append(*h, n)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return n
+}
+
+// track adds the node to the expiry heap.
+func (s *Scores) track(n *Node) {
+	if s.ttl <= 0 {
+		return
+	}
+	heap.Push(&s.expiry, n)
+}
+
+// retrack replaces the node old with the node n in the expiry heap, moving it after its time changed.
+func (s *Scores) retrack(old, n *Node) {
+	if s.ttl <= 0 {
+		return
+	}
+	n.index = old.index
+	s.expiry[n.index] = n
+	heap.Fix(&s.expiry, n.index)
+}
+
+// untrack removes the node from the expiry heap.
+func (s *Scores) untrack(n *Node) {
+	if s.ttl <= 0 {
+		return
+	}
+	heap.Remove(&s.expiry, n.index)
+}
@@ -0,0 +1,96 @@
+package scores
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clock is a fake clock for expiring scores.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+// TestExpiry tests that expired scores are not returned, whether they were swept or not.
+func TestExpiry(t *testing.T) {
+	c := &clock{t: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	s := New(WithExpiry(time.Hour))
+	s.now = c.now
+	s.Add(Score{User: 1, Value: 10})
+	c.t = c.t.Add(20 * time.Minute)
+	s.Add(Score{User: 2, Value: 20})
+	s.Add(Score{User: 3, Value: 30})
+	c.t = c.t.Add(20 * time.Minute)
+	// a new score postpones the expiry, an unchanged one does not
+	s.Update(Score{User: 2, Value: 5})
+	s.Update(Score{User: 3, Value: 0})
+	s.Submit(1, 5, KeepBest)
+	testCases := []struct {
+		after    time.Duration
+		expected []Score
+	}{
+		{19 * time.Minute, []Score{{3, 30}, {2, 25}, {1, 10}}},
+		{time.Minute, []Score{{3, 30}, {2, 25}}},
+		{20 * time.Minute, []Score{{2, 25}}},
+		{20 * time.Minute, nil},
+	}
+	for _, tc := range testCases {
+		c.t = c.t.Add(tc.after)
+		if calculated := s.Top(10); !reflect.DeepEqual(calculated, tc.expected) {
+			t.Fatalf("got scores at %v: %v, expected: %v", c.t, calculated, tc.expected)
+		}
+		if calculated, expected := s.Len(), len(tc.expected); calculated != expected {
+			t.Fatalf("got %d users at %v, expected: %d", calculated, c.t, expected)
+		}
+		assertBalanced(t, s)
+	}
+	s.Add(Score{User: 1, Value: 1})
+	c.t = c.t.Add(2 * time.Hour)
+	if calculated, expected := s.Sweep(), 1; calculated != expected {
+		t.Fatalf("got %d swept scores, expected: %d", calculated, expected)
+	}
+}
+
+// TestExpiryReplay tests that scores expire the same way after reopening them,
+// even if users added again after their scores expired.
+func TestExpiryReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	c := &clock{t: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	open := func() *Scores {
+		s, err := Open(path, WithExpiry(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.now = c.now
+		return s
+	}
+	s := open()
+	s.Add(Score{User: 1, Value: 10})
+	s.Add(Score{User: 2, Value: 20})
+	c.t = c.t.Add(30 * time.Minute)
+	s.Update(Score{User: 2, Value: 1})
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	c.t = c.t.Add(time.Hour)
+	if err := s.Add(Score{User: 1, Value: 5}); err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Score{User: 3, Value: 7})
+	expected := s.Top(10)
+	s.Close()
+	s = open()
+	defer s.Close()
+	if calculated := s.Top(10); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got reopened scores: %v, expected: %v", calculated, expected)
+	}
+	c.t = c.t.Add(time.Hour)
+	if calculated := s.Top(10); calculated != nil {
+		t.Fatalf("got scores after expiry: %v, expected none", calculated)
+	}
+}
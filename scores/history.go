@@ -0,0 +1,161 @@
+package scores
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// MaxReasonSize is the maximum size of the reason of a change, in bytes.
+const MaxReasonSize = 1024
+
+// DefaultHistoryLimit is how many changes of every user are kept by default, if scores keep history.
+const DefaultHistoryLimit = 1000
+
+// WithHistory keeps the history of every user: every score added for it, every update of it and its removal.
+//
+// The history is kept even after the user is removed, until it is erased, and it is persisted together with the scores.
+// Only the latest DefaultHistoryLimit changes of every user are kept, unless WithHistoryLimit sets another limit.
+func WithHistory() Option {
+	return func(s *Scores) {
+		s.history = make(map[int][]HistoryEntry)
+	}
+}
+
+// WithHistoryLimit keeps only the latest limit changes of every user, if scores keep history.
+func WithHistoryLimit(limit int) Option {
+	return func(s *Scores) {
+		s.historyLimit = limit
+	}
+}
+
+// HistoryEntry is a change of the score of a user.
+type HistoryEntry struct {
+	Seq     int       // number of the change among the changes of the user, starting from 1
+	Delta   int       // how much the score changed, which is the whole score when it was added
+	Total   int       // score of the user after the change
+	Time    time.Time // when the score changed
+	Reason  string    // why the score changed, if it was given
+	Removed bool      // whether the user was removed, or its score expired, so it had no score after the change
+}
+
+// AddWithReason adds a new score for the user, as by Add, recording the reason in its history.
+func (s *Scores) AddWithReason(score Score, reason string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	_, err := s.mutate(record{op: opAdd, user: score.User, value: score.Value, reason: reason})
+	return err
+}
+
+// UpdateWithReason updates the score of an existing user, as by Update, recording the reason in its history.
+func (s *Scores) UpdateWithReason(score Score, reason string) (Score, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	v, err := s.mutate(record{op: opUpdate, user: score.User, value: score.Value, reason: reason})
+	return v.Score, err
+}
+
+// History returns at most limit changes of the score of the user, from the latest to the earliest,
+// starting with the one before the change numbered before, or with the latest one if before is 0.
+//
+// The Seq of the last returned change can be used as before, to get the earlier changes.
+func (s *Scores) History(user int, before int, limit int) ([]HistoryEntry, error) {
+	// the history has the expiry of the scores which expired by now
+	s.rlock()
+	defer s.mu.RUnlock()
+	if s.history == nil {
+		return nil, fmt.Errorf("scores do not keep history")
+	}
+	entries, ok := s.history[user]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUserNotFound, user)
+	}
+	// the earliest changes may be dropped, so the changes are numbered from the one of the first kept change
+	end := len(entries)
+	if before > 0 && before-entries[0].Seq < end {
+		end = before - entries[0].Seq
+	}
+	var result []HistoryEntry
+	for i := end - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, entries[i])
+	}
+	return result, nil
+}
+
+// Erase removes the user, if it has a score, together with its history.
+//
+// The erasure is logged, so the history is not restored after a restart,
+// but the logged changes of the user are removed from the disk only by the next Checkpoint.
+func (s *Scores) Erase(user int) error {
+	s.mu.Lock()
+	defer s.unlock()
+	_, err := s.mutate(record{op: opErase, user: user})
+	return err
+}
+
+// purge erases the user, as by Erase, from scores which are closed.
+//
+// Closed scores cannot log the erasure, so if they are persisted their snapshot is rewritten without the user,
+// and their log is emptied, since the snapshot has all of its records.
+func (s *Scores) purge(user int) error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	s.mu.Lock()
+	defer s.unlock()
+	if _, ok := s.users[user]; !ok && s.history[user] == nil {
+		return nil
+	}
+	r := record{op: opErase, user: user}
+	s.apply(r)
+	s.remember(r, 0, 0)
+	if s.path == "" {
+		return nil
+	}
+	snap := s.snapshot()
+	snap.lsn = s.lsn
+	if err := s.writeSnapshot(snap); err != nil {
+		return err
+	}
+	tmp := s.path + LogExt + ".tmp"
+	if err := writeFile(tmp, logHeader()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path+LogExt); err != nil {
+		return err
+	}
+	return syncDir(s.dir())
+}
+
+// remember appends the applied mutation to the history of its user, if the scores keep history.
+//
+// before and total are the scores of the user before and after the mutation.
+func (s *Scores) remember(r record, before int, total int) {
+	if s.history == nil {
+		return
+	}
+	entry := HistoryEntry{Delta: total - before, Total: total, Time: time.Unix(0, r.at), Reason: r.reason}
+	switch r.op {
+	case opAdd, opUpdate:
+	case opRemove:
+		entry.Removed = true
+	case opErase:
+		delete(s.history, r.user)
+		return
+	default:
+		return
+	}
+	entries := s.history[r.user]
+	entry.Seq = 1
+	if len(entries) > 0 {
+		entry.Seq = entries[len(entries)-1].Seq + 1
+	}
+	limit := s.historyLimit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if len(entries) >= limit {
+		// snapshots share the entries, so they are dropped by slicing instead of copying the remaining ones
+		entries = entries[len(entries)-limit+1:]
+	}
+	s.history[r.user] = append(entries, entry)
+}
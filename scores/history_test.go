@@ -0,0 +1,161 @@
+package scores
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestHistory tests that every change of a score, including its removal, is kept, also after reopening the scores,
+// and that it can be paginated.
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	c := &clock{t: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	open := func() *Scores {
+		s, err := Open(path, WithHistory())
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.now = c.now
+		return s
+	}
+	s := open()
+	var expected []HistoryEntry
+	change := func(delta, total int, reason string, removed bool) {
+		expected = append([]HistoryEntry{{len(expected) + 1, delta, total, c.t, reason, removed}}, expected...)
+		c.t = c.t.Add(time.Minute)
+	}
+	s.AddWithReason(Score{User: 1, Value: 10}, "level 1")
+	change(10, 10, "level 1", false)
+	s.Add(Score{User: 2, Value: 5})
+	s.UpdateWithReason(Score{User: 1, Value: -40}, "cheating")
+	change(-40, -30, "cheating", false)
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	s.Submit(1, 20, KeepLatest)
+	change(50, 20, "", false)
+	// submissions that do not change the score are not changes
+	s.Submit(1, 10, KeepBest)
+	s.Remove(1)
+	change(-20, 0, "", true)
+	s.Add(Score{User: 1, Value: 3})
+	change(3, 3, "", false)
+	s.Close()
+	s = open()
+	defer s.Close()
+	var calculated []HistoryEntry
+	for before := 0; ; {
+		entries, err := s.History(1, before, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		calculated = append(calculated, entries...)
+		before = entries[len(entries)-1].Seq
+	}
+	for i := range calculated {
+		calculated[i].Time = calculated[i].Time.UTC()
+	}
+	if !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got history: \n%v\n expected: \n%v\n", calculated, expected)
+	}
+	if _, err := s.History(3, 0, 10); err == nil {
+		t.Fatalf("expected error for user without history")
+	}
+}
+
+// TestHistoryLimit tests that only the latest changes of a user are kept, also after reopening the scores,
+// and that they keep their numbers.
+func TestHistoryLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path, WithHistory(), WithHistoryLimit(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Score{User: 1, Value: 1})
+	for i := 0; i < 10; i++ {
+		s.Update(Score{User: 1, Value: 1})
+	}
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	s.Update(Score{User: 1, Value: 1})
+	s.Close()
+	if s, err = Open(path, WithHistory(), WithHistoryLimit(3)); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var seqs []int
+	for before := 0; ; {
+		entries, err := s.History(1, before, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		for _, entry := range entries {
+			seqs = append(seqs, entry.Seq)
+			if entry.Total != entry.Seq {
+				t.Fatalf("got change %v, expected total: %d", entry, entry.Seq)
+			}
+		}
+		before = entries[len(entries)-1].Seq
+	}
+	if expected := []int{12, 11, 10}; !reflect.DeepEqual(seqs, expected) {
+		t.Fatalf("got changes %v, expected: %v", seqs, expected)
+	}
+}
+
+// TestHistoryErase tests that erasing a user removes its score and its history, also after reopening the scores.
+func TestHistoryErase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	c := &clock{t: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	open := func() *Scores {
+		s, err := Open(path, WithHistory(), WithExpiry(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.now = c.now
+		return s
+	}
+	s := open()
+	s.Add(Score{User: 1, Value: 10})
+	s.Add(Score{User: 2, Value: 20})
+	s.Add(Score{User: 3, Value: 30})
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	c.t = c.t.Add(2 * time.Hour)
+	s.Add(Score{User: 4, Value: 40})
+	// the expired scores are in the history
+	if entries, err := s.History(2, 0, 10); err != nil || len(entries) != 2 || !entries[0].Removed || entries[0].Reason != "expired" ||
+		!entries[0].Time.Equal(c.t.Add(-time.Hour)) {
+		t.Fatalf("got history of an expired score: %v, %v", entries, err)
+	}
+	s.Add(Score{User: 1, Value: 5})
+	for _, user := range []int{1, 2, 5} {
+		if err := s.Erase(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	s = open()
+	defer s.Close()
+	for _, user := range []int{1, 2} {
+		if _, err := s.History(user, 0, 10); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("got error %v for the history of an erased user, expected: %v", err, ErrUserNotFound)
+		}
+	}
+	if calculated, expected := s.Top(10), []Score{{4, 40}}; !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores after erasing: %v, expected: %v", calculated, expected)
+	}
+	if entries, err := s.History(3, 0, 10); err != nil || len(entries) != 2 {
+		t.Fatalf("got history of a user which was not erased: %v, %v", entries, err)
+	}
+}
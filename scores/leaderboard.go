@@ -0,0 +1,44 @@
+package scores
+
+// Leaderboard ranks the scores of users.
+//
+// It is implemented by Scores, which keeps the scores in a single tree, and by Sharded, which keeps them in several,
+// so users of the scores can choose either, or their own implementation. Implementations must be thread safe.
+type Leaderboard interface {
+	// Add adds a new score for the user.
+	Add(score Score) error
+	// Update adds the value of the score to the score of an existing user, and returns its new score.
+	Update(score Score) (Score, error)
+	// Remove removes the user and its score.
+	Remove(user int) error
+	// Apply applies the mutation, skipping it if its idempotency key was already applied.
+	Apply(m Mutation) (VersionedScore, error)
+	// SubmitIdempotent submits a score achieved by the user, kept according to the policy.
+	SubmitIdempotent(key string, user int, value int, policy SubmitPolicy, reason string) (Submission, error)
+
+	// Top returns top scores from best to worst.
+	Top(top int) []Score
+	// TopRanked returns top scores from best to worst, annotated with their rank according to mode.
+	TopRanked(top int, mode RankMode) []RankedScore
+	// Range returns scores ranked between position-count and position+count, from best to worst.
+	Range(position int, count int) []Score
+	// RangeRanked returns the scores returned by Range, annotated with their rank according to mode.
+	RangeRanked(position int, count int, mode RankMode) []RankedScore
+	// RankOf returns the rank of the user, according to RankMode, together with its score.
+	RankOf(user int) (int, Score, error)
+	// PositionOf returns the ordinal rank of the user, whatever RankMode, so it is the position of its score.
+	PositionOf(user int) (int, error)
+	// Lookup returns the score of the user, with its rank according to RankMode, and its version.
+	Lookup(user int) (RankedScore, uint64, error)
+	// AroundUser returns the scores ranked between rank-count and rank+count, where rank is the rank of the user.
+	AroundUser(user int, count int) ([]RankedScore, error)
+	// Len returns the number of users that have a score.
+	Len() int
+	// RankMode returns the rank mode used by RankOf, Lookup and AroundUser.
+	RankMode() RankMode
+}
+
+var (
+	_ Leaderboard = (*Scores)(nil)
+	_ Leaderboard = (*Sharded)(nil)
+)
@@ -0,0 +1,225 @@
+package scores
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLeaderboardScores tests that Scores conforms to Leaderboard.
+func TestLeaderboardScores(t *testing.T) {
+	testLeaderboard(t, func(options ...Option) Leaderboard { return New(options...) })
+}
+
+// TestLeaderboardSharded tests that Sharded conforms to Leaderboard, with a single shard and with several.
+func TestLeaderboardSharded(t *testing.T) {
+	for _, n := range []int{1, 4} {
+		t.Run(fmt.Sprintf("shards=%d", n), func(t *testing.T) {
+			testLeaderboard(t, func(options ...Option) Leaderboard { return NewSharded(n, options...) })
+		})
+	}
+}
+
+// testLeaderboard is the conformance suite of Leaderboard, which every implementation must pass.
+//
+// newLeaderboard returns an empty leaderboard with the given options.
+func testLeaderboard(t *testing.T, newLeaderboard func(options ...Option) Leaderboard) {
+	t.Run("mutations", func(t *testing.T) {
+		l := newLeaderboard()
+		if err := l.Add(Score{User: 1, Value: 10}); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Add(Score{User: 1, Value: 20}); err == nil {
+			t.Fatalf("expected error for an existing user")
+		}
+		if score, err := l.Update(Score{User: 1, Value: 5}); err != nil || score != (Score{User: 1, Value: 15}) {
+			t.Fatalf("got updated score %v, %v, expected: {1 15}", score, err)
+		}
+		if _, err := l.Update(Score{User: 2, Value: 5}); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("got error %v for updating a missing user, expected: %v", err, ErrUserNotFound)
+		}
+		if err := l.Remove(2); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("got error %v for removing a missing user, expected: %v", err, ErrUserNotFound)
+		}
+		if err := l.Remove(1); err != nil {
+			t.Fatal(err)
+		}
+		if l.Len() != 0 || l.Top(10) != nil {
+			t.Fatalf("got %d users with top %v after removing all of them", l.Len(), l.Top(10))
+		}
+		if _, _, err := l.RankOf(1); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("got error %v for the rank of a removed user, expected: %v", err, ErrUserNotFound)
+		}
+	})
+	t.Run("queries", func(t *testing.T) {
+		random := rand.New(rand.NewSource(time.Now().UnixNano()))
+		l := newLeaderboard()
+		var expected []Score
+		for user := 1; user <= 200; user++ {
+			// distinct scores, so the order does not depend on the tie break
+			score := Score{User: user, Value: 1000 - 5*user + random.Intn(5)}
+			l.Add(score)
+			expected = append(expected, score)
+		}
+		if l.Len() != len(expected) {
+			t.Fatalf("got %d users, expected: %d", l.Len(), len(expected))
+		}
+		for _, top := range []int{0, 1, 50, 200, 300} {
+			end := top
+			if end > len(expected) {
+				end = len(expected)
+			}
+			if calculated := l.Top(top); len(calculated) != end || (end > 0 && !reflect.DeepEqual(calculated, expected[:end])) {
+				t.Fatalf("got top %d: \n%v\n expected: \n%v\n", top, calculated, expected[:end])
+			}
+		}
+		for _, position := range []int{1, 3, 100, 200, 205} {
+			start, end := position-5, position+5
+			if start < 1 {
+				start = 1
+			}
+			if end > len(expected) {
+				end = len(expected)
+			}
+			calculated := l.RangeRanked(position, 5, OrdinalRank)
+			var want []RankedScore
+			for i := start; i <= end; i++ {
+				want = append(want, RankedScore{Score: expected[i-1], Rank: i})
+			}
+			if !reflect.DeepEqual(calculated, want) {
+				t.Fatalf("got range at %d: \n%v\n expected: \n%v\n", position, calculated, want)
+			}
+			if scores := l.Range(position, 5); len(scores) != len(want) {
+				t.Fatalf("got %d scores at %d, expected: %d", len(scores), position, len(want))
+			}
+		}
+		for i, score := range expected {
+			rank, value, err := l.RankOf(score.User)
+			if err != nil || rank != i+1 || value != score {
+				t.Fatalf("got rank %d of %v, %v, expected: %d of %v", rank, value, err, i+1, score)
+			}
+			ranked, _, err := l.Lookup(score.User)
+			if err != nil || ranked != (RankedScore{Score: score, Rank: i + 1}) {
+				t.Fatalf("got lookup %v, %v, expected: %v", ranked, err, RankedScore{Score: score, Rank: i + 1})
+			}
+		}
+		around, err := l.AroundUser(expected[0].User, 2)
+		if err != nil || len(around) != 3 || around[0].Score != expected[0] || around[2].Rank != 3 {
+			t.Fatalf("got scores around the best user: %v, %v", around, err)
+		}
+	})
+	t.Run("order and ties", func(t *testing.T) {
+		for _, c := range []struct {
+			options  []Option
+			expected []int // users, from best to worst
+			ranks    []int // ranks of the users, according to the rank mode
+		}{
+			{nil, []int{4, 2, 3, 1}, []int{1, 2, 3, 4}},
+			{[]Option{WithTieBreak(FirstAchieverWins)}, []int{4, 1, 3, 2}, []int{1, 2, 3, 4}},
+			{[]Option{WithTieBreak(LowerUserWins)}, []int{4, 1, 2, 3}, []int{1, 2, 3, 4}},
+			{[]Option{WithTieBreak(SharedRank)}, []int{4, 1, 2, 3}, []int{1, 2, 2, 2}},
+			{[]Option{WithRankMode(DenseRank)}, []int{4, 2, 3, 1}, []int{1, 2, 2, 2}},
+			{[]Option{WithOrder(Ascending)}, []int{2, 3, 1, 4}, []int{1, 2, 3, 4}},
+		} {
+			l := newLeaderboard(c.options...)
+			l.Add(Score{User: 1, Value: 20})
+			l.Add(Score{User: 2, Value: 10})
+			l.Add(Score{User: 3, Value: 10})
+			l.Add(Score{User: 4, Value: 25})
+			l.Update(Score{User: 3, Value: 10})
+			l.Update(Score{User: 2, Value: 5})
+			l.Update(Score{User: 2, Value: 5})
+			// now users 1, 3 and 2 have 20, reached in this order, and user 4 has 25
+			var users, ranks []int
+			for _, score := range l.Top(4) {
+				users = append(users, score.User)
+				rank, _, _ := l.RankOf(score.User)
+				ranks = append(ranks, rank)
+			}
+			if !reflect.DeepEqual(users, c.expected) || !reflect.DeepEqual(ranks, c.ranks) {
+				t.Fatalf("got users %v ranked %v, expected: %v ranked %v", users, ranks, c.expected, c.ranks)
+			}
+			ranked := l.TopRanked(4, l.RankMode())
+			for i := range ranked {
+				if ranked[i].Rank != c.ranks[i] {
+					t.Fatalf("got top ranked %v, expected ranks: %v", ranked, c.ranks)
+				}
+			}
+		}
+	})
+	t.Run("versions and keys", func(t *testing.T) {
+		l := newLeaderboard(WithDedup(10))
+		added, err := l.Apply(Mutation{Kind: MutationAdd, User: 1, Value: 10, Key: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, err := l.Apply(Mutation{Kind: MutationAdd, User: 1, Value: 10, Key: "a"}); err != nil || again != added {
+			t.Fatalf("got repeated mutation %v, %v, expected: %v", again, err, added)
+		}
+		if _, version, _ := l.Lookup(1); version != added.Version {
+			t.Fatalf("got version %d, expected: %d", version, added.Version)
+		}
+		updated, err := l.Apply(Mutation{Kind: MutationUpdate, User: 1, Value: 5, Version: added.Version})
+		if err != nil || updated.Value != 15 || updated.Version == added.Version {
+			t.Fatalf("got update %v, %v, after %v", updated, err, added)
+		}
+		if _, err := l.Apply(Mutation{Kind: MutationUpdate, User: 1, Value: 5, Version: added.Version}); !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("got error %v for an old version, expected: %v", err, ErrVersionMismatch)
+		}
+		if _, err := l.Apply(Mutation{Kind: MutationRemove, User: 1}); err != nil || l.Len() != 0 {
+			t.Fatalf("got %d users after removing, %v", l.Len(), err)
+		}
+	})
+	t.Run("submissions", func(t *testing.T) {
+		l := newLeaderboard()
+		l.Add(Score{User: 1, Value: 50})
+		for _, c := range []struct {
+			value    int
+			policy   SubmitPolicy
+			expected Submission
+		}{
+			{30, KeepBest, Submission{Score: Score{User: 2, Value: 30}, Rank: 2, Created: true}},
+			{20, KeepBest, Submission{Score: Score{User: 2, Value: 30}, Rank: 2, PreviousRank: 2}},
+			{60, KeepBest, Submission{Score: Score{User: 2, Value: 60}, Rank: 1, PreviousRank: 2}},
+			{10, KeepLatest, Submission{Score: Score{User: 2, Value: 10}, Rank: 2, PreviousRank: 1}},
+			{45, Accumulate, Submission{Score: Score{User: 2, Value: 55}, Rank: 1, PreviousRank: 2}},
+		} {
+			sub, err := l.SubmitIdempotent("", 2, c.value, c.policy, "")
+			sub.Version = 0
+			if err != nil || sub != c.expected {
+				t.Fatalf("got submission of %d with policy %v: %v, %v, expected: %v", c.value, c.policy, sub, err, c.expected)
+			}
+		}
+	})
+	t.Run("concurrency", func(t *testing.T) {
+		l := newLeaderboard()
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					user := w*100 + i
+					l.Add(Score{User: user, Value: i})
+					l.Update(Score{User: user, Value: 1})
+					l.Top(10)
+					l.RankOf(user)
+				}
+			}(w)
+		}
+		wg.Wait()
+		if l.Len() != 800 {
+			t.Fatalf("got %d users, expected: 800", l.Len())
+		}
+		top := l.TopRanked(800, OrdinalRank)
+		for i := 1; i < len(top); i++ {
+			if top[i].Value > top[i-1].Value || top[i].Rank != i+1 {
+				t.Fatalf("got unsorted scores at %d: %v, %v", i, top[i-1], top[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package scores
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Load loads the scores returned by next, sorted from best to worst, into empty scores.
+//
+// next returns io.EOF after the last score. Equal scores are ranked in the order they come,
+// so with the LowerUserWins and SharedRank tie breaks they must be sorted by user.
+//
+// Instead of inserting the scores one by one, Load builds a perfectly balanced tree from them in O(n).
+// Persisted scores are then checkpointed, instead of logging every score.
+// The scores are locked only after all of them are read and checked, so a slow next does not block
+// other users of the scores, and if loading fails they stay empty.
+func (s *Scores) Load(next func() (Score, error)) error {
+	// fail early, before reading all scores
+	s.mu.RLock()
+	err := s.loadable()
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	nodes, err := s.readSorted(next)
+	if err != nil {
+		return err
+	}
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	s.mu.Lock()
+	defer s.unlock()
+	if err := s.loadable(); err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		node.seq += s.seq
+	}
+	return s.load(nodes)
+}
+
+// loadable returns an error if scores cannot be loaded, because they are closed or not empty.
+func (s *Scores) loadable() error {
+	if s.closed {
+		return ErrClosed
+	}
+	if len(s.users) > 0 {
+		return errors.New("cannot load scores into scores which are not empty")
+	}
+	return nil
+}
+
+// readNodes returns the nodes of the scores returned by next, in the same order, without sequence numbers.
+func readNodes(next func() (Score, error)) ([]*Node, error) {
+	var nodes []*Node
+	users := make(map[int]bool)
+	for {
+		score, err := next()
+		if err == io.EOF {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if users[score.User] {
+			return nil, fmt.Errorf("Existing user: %d", score.User)
+		}
+		users[score.User] = true
+		nodes = append(nodes, &Node{score: score.Value, user: score.User})
+	}
+}
+
+// readSorted returns the nodes of the scores returned by next, which must be sorted from best to worst.
+//
+// The nodes have sequence numbers starting from 1, in the order of their achievement,
+// so the sequence numbers after the last one of the scores must be added to them.
+func (s *Scores) readSorted(next func() (Score, error)) ([]*Node, error) {
+	nodes, err := readNodes(next)
+	if err != nil {
+		return nil, err
+	}
+	for i, node := range nodes {
+		// later achievers win by default, so the better of equal scores get the later sequence numbers
+		node.seq = uint64(len(nodes) - i)
+		if s.tieBreak == FirstAchieverWins {
+			node.seq = uint64(i + 1)
+		}
+		if i > 0 && !s.below(node, nodes[i-1]) {
+			return nil, fmt.Errorf("scores are not sorted: user %d after user %d", node.user, nodes[i-1].user)
+		}
+	}
+	return nodes, nil
+}
+
+// load loads the nodes, sorted from best to worst and with their sequence numbers, into the loadable scores.
+//
+// The scores lock must be held, together with the checkpoint lock.
+func (s *Scores) load(nodes []*Node) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	s.install(nodes)
+	if s.log == nil {
+		return nil
+	}
+	if err := s.stageSnapshot(s.snapshot()); err != nil {
+		s.uninstall()
+		return err
+	}
+	if err := s.commitLoad(); err != nil {
+		if rollbackErr := s.rollbackLoad(); rollbackErr != nil {
+			return fmt.Errorf("%w, and rolling back the load failed: %v", err, rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// install links the nodes, sorted from best to worst and with their sequence numbers, into the loadable scores.
+func (s *Scores) install(nodes []*Node) {
+	if len(nodes) == 0 {
+		return
+	}
+	// the tree keeps the worst score on the left
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	s.root = build(nodes)
+	s.top.invalidate()
+	s.changed = true
+	for _, node := range nodes {
+		node.gen = s.gen
+		s.users[node.user] = node
+		if node.seq > s.seq {
+			s.seq = node.seq
+		}
+	}
+	if s.ttl > 0 {
+		now := s.now().UnixNano()
+		for i, node := range nodes {
+			node.at, node.index = now, i
+		}
+		s.expiry = expiryHeap(append([]*Node(nil), nodes...))
+		heap.Init(&s.expiry)
+	}
+	s.userIndex = s.buildUsers(nodes)
+}
+
+// uninstall empties the scores again, after installing nodes which cannot be persisted.
+func (s *Scores) uninstall() {
+	s.root, s.users, s.userIndex, s.expiry = nil, make(map[int]*Node), nil, nil
+	s.top.invalidate()
+	s.changed = true
+}
+
+// commitLoad replaces the snapshot of the persisted scores with the staged one, which has the installed nodes,
+// and removes the records before it from the log.
+func (s *Scores) commitLoad() error {
+	if err := s.commitSnapshot(); err != nil {
+		return err
+	}
+	return s.log.compact(s.log.size)
+}
+
+// rollbackLoad empties the scores again, after committing the installed nodes failed.
+//
+// The snapshot with the nodes may have replaced the previous one already, so it is replaced in turn by a snapshot
+// of the empty scores, which has all the records of the log, as the previous snapshot together with the log had.
+func (s *Scores) rollbackLoad() error {
+	s.uninstall()
+	if s.log == nil {
+		return nil
+	}
+	s.discardSnapshot()
+	return s.writeSnapshot(s.snapshot())
+}
+
+// build links the nodes, sorted from worst to best, into a perfectly balanced tree, and returns its root.
+func build(nodes []*Node) *Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+	mid := len(nodes) / 2
+	n := nodes[mid]
+	n.left = build(nodes[:mid])
+	n.right = build(nodes[mid+1:])
+	n.fix()
+	return n
+}
@@ -0,0 +1,148 @@
+package scores
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestLoad tests that loading sorted scores gives a perfectly balanced tree,
+// ranking the scores as if they were added one by one.
+func TestLoad(t *testing.T) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for _, tieBreak := range []TieBreak{LastAchieverWins, FirstAchieverWins, LowerUserWins} {
+		added := New(WithTieBreak(tieBreak))
+		for i := 0; i < 1000; i++ {
+			added.Add(Score{User: i, Value: random.Intn(100)})
+		}
+		expected := added.Top(1000)
+		s := New(WithTieBreak(tieBreak))
+		if err := s.Load(sliceScores(expected)); err != nil {
+			t.Fatal(err)
+		}
+		if calculated := s.Top(1000); !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("%v: got loaded scores: \n%v\n expected: \n%v\n", tieBreak, calculated, expected)
+		}
+		assertBalanced(t, s)
+		// 1000 nodes fit in a perfectly balanced tree of height 10
+		if s.root.height != 10 {
+			t.Fatalf("%v: got height %d, expected: 10", tieBreak, s.root.height)
+		}
+		// scores achieved after loading break ties as usual
+		for _, update := range []Score{{1001, 50}, {500, 0}} {
+			added.Add(update)
+			s.Add(update)
+		}
+		if calculated, expected := s.Top(1002), added.Top(1002); !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("%v: got scores after loading: \n%v\n expected: \n%v\n", tieBreak, calculated, expected)
+		}
+		if err := s.Load(sliceScores(expected)); err == nil {
+			t.Fatalf("expected error for scores which are not empty")
+		}
+	}
+	if err := New().Load(sliceScores([]Score{{1, 10}, {2, 20}})); err == nil {
+		t.Fatalf("expected error for unsorted scores")
+	}
+}
+
+// TestLoadPersisted tests that loaded scores are persisted.
+func TestLoadPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Score{User: 1, Value: 10})
+	s.Remove(1)
+	expected := []Score{{3, 30}, {1, 20}, {2, 20}}
+	if err := s.Load(sliceScores(expected)); err != nil {
+		t.Fatal(err)
+	}
+	s.Update(Score{User: 2, Value: 5})
+	expected = s.Top(10)
+	s.Close()
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if calculated := s.Top(10); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got reopened scores: %v, expected: %v", calculated, expected)
+	}
+	assertBalanced(t, s)
+}
+
+// TestLoadRollback tests that scores whose loaded scores cannot be committed stay empty, also after reopening them.
+func TestLoadRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Score{User: 1, Value: 10})
+	s.Remove(1)
+	// compacting the log fails after the snapshot with the loaded scores replaced the previous one
+	if err := os.Mkdir(path+LogExt+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(sliceScores([]Score{{2, 20}, {3, 10}})); err == nil {
+		t.Fatalf("expected error loading scores which cannot be committed")
+	}
+	if n := s.Len(); n != 0 {
+		t.Fatalf("got %d scores after failing to load them, expected none", n)
+	}
+	assertBalanced(t, s)
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if calculated := s.Top(10); calculated != nil {
+		t.Fatalf("got reopened scores: %v, expected none", calculated)
+	}
+}
+
+// sliceScores returns a function which returns the scores one by one, as needed by Load.
+func sliceScores(scores []Score) func() (Score, error) {
+	return func() (Score, error) {
+		if len(scores) == 0 {
+			return Score{}, io.EOF
+		}
+		score := scores[0]
+		scores = scores[1:]
+		return score, nil
+	}
+}
+
+// TestLoadSlowReader tests that the scores can be queried and changed while the scores to load are read.
+func TestLoadSlowReader(t *testing.T) {
+	for _, l := range []interface {
+		Leaderboard
+		Load(next func() (Score, error)) error
+	}{New(), NewSharded(3)} {
+		read, done := make(chan bool), make(chan error)
+		var sent bool
+		go func() {
+			done <- l.Load(func() (Score, error) {
+				if sent {
+					return Score{}, io.EOF
+				}
+				// blocks until the scores were used
+				<-read
+				sent = true
+				return Score{User: 1, Value: 10}, nil
+			})
+		}()
+		l.Top(10)
+		l.Add(Score{User: 2, Value: 20})
+		close(read)
+		if err := <-done; err == nil {
+			t.Fatalf("expected error for scores which are not empty when loaded")
+		}
+		if calculated, expected := l.Top(10), []Score{{2, 20}}; !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("got scores: %v, expected: %v", calculated, expected)
+		}
+	}
+}
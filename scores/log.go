@@ -0,0 +1,579 @@
+package scores
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrLogFailed is returned, wrapped, when a mutation cannot be written to the log, so it was not applied.
+var ErrLogFailed = errors.New("log failed")
+
+// logError is an error of appending to the log, which is ErrLogFailed.
+type logError struct {
+	op  string
+	err error
+}
+
+func (e *logError) Error() string {
+	return e.op + ": " + e.err.Error()
+}
+
+func (e *logError) Unwrap() error {
+	return e.err
+}
+
+func (e *logError) Is(target error) bool {
+	return target == ErrLogFailed
+}
+
+// Log is an append only file with the mutations of our scores, so we can replay them after a restart.
+//
+// The file starts with logMagic and the version of its format, followed by the records.
+// Every record is written as its payload length, the crc32 checksum of the payload
+// and the crc32 checksum of these first 8 bytes, all as 4 bytes little endian, followed by the payload.
+// Every append is synced to disk before the mutation is applied in memory.
+//
+// Not thread safe, it is guarded by the lock of the scores.
+type Log struct {
+	f    *os.File
+	path string
+	size int64  // size of the file header and of the valid records in the file
+	lsn  uint64 // sequence number of the last record
+	err  error  // if not nil, the log cannot be appended to, because a failed append could not be undone
+	buf  []byte
+}
+
+// op is the kind of mutation stored in a log record.
+type op byte
+
+const (
+	opAdd op = iota + 1
+	opUpdate
+	opRemove
+	opBatch // the mutations of a batch, applied together
+	opErase // removes the user, if it has a score, and its history
+)
+
+// record is a mutation of the scores, as stored in the log.
+type record struct {
+	lsn    uint64
+	op     op
+	user   int
+	value  int
+	at     int64  // when the mutation happened, as unix nanoseconds, only if scores expire or keep history
+	reason string // why the score changed, for the history
+	key    string // idempotency key of the mutation, for the dedup table
+	seq    uint64 // sequence number of the achieved score, only if it is shared with other scores
+	// if not 0, the version the score of the user must have, which is checked but not logged
+	version uint64
+	batch   []record // mutations of a batch, which do not have their own sequence numbers
+}
+
+// records returns the mutations of the record, which are the mutations of its batch if it is a batch.
+func (r record) records() []record {
+	if r.op == opBatch {
+		return r.batch
+	}
+	return []record{r}
+}
+
+const (
+	logMagic   = "GSWL"
+	logVersion = 1
+	// logHeaderSize is the size of the header of the file, logMagic followed by the version.
+	logHeaderSize = len(logMagic) + 1
+	// recordHeaderSize is the size of the header of a record.
+	recordHeaderSize = 12
+	// maxRecordSize is the maximum size of the payload of a record, so a corrupted length
+	// cannot make us read past the next records.
+	maxRecordSize = 64 << 20
+)
+
+// Extensions of the files where Open persists the scores.
+const (
+	LogExt      = ".wal"
+	SnapshotExt = ".snap"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Open returns the scores persisted at path, creating them if they do not exist.
+//
+// The scores are persisted in two files: the snapshot written by the last Checkpoint at path.snap,
+// and the log of mutations applied after that snapshot at path.wal.
+// Every mutation of the returned scores is appended to the log before it is applied.
+// If the last record of the log was only partially written, because of a crash, it is discarded.
+// The options should be the same every time the scores are opened.
+func Open(path string, options ...Option) (*Scores, error) {
+	s := New(options...)
+	var lsn uint64
+	if f, err := os.Open(path + SnapshotExt); err == nil {
+		snap, err := readSnapshot(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("restoring snapshot %s: %w", path+SnapshotExt, err)
+		}
+		s.restore(snap)
+		lsn = snap.lsn
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := openLog(path+LogExt, lsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.replay(s); err != nil {
+		l.f.Close()
+		return nil, fmt.Errorf("replaying log %s: %w", l.path, err)
+	}
+	s.log = l
+	s.path = path
+	s.publish()
+	return s, nil
+}
+
+// Close closes the log of the scores, if they have one.
+//
+// The scores cannot be modified after this call.
+func (s *Scores) Close() error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	s.mu.Lock()
+	defer s.unlock()
+	s.closed = true
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.f.Close()
+	s.lsn = s.log.lsn
+	s.log = nil
+	return err
+}
+
+// dir returns the directory where the scores are persisted.
+func (s *Scores) dir() string {
+	return filepath.Dir(s.path)
+}
+
+// journal appends the mutation to the log, if the scores have one.
+func (s *Scores) journal(r record) error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.log == nil {
+		return nil
+	}
+	return s.log.append(r)
+}
+
+// openLog opens the log file at path, creating it if it does not exist.
+//
+// Records with sequence numbers up to lsn are already applied, and they will be skipped by replay.
+func openLog(path string, lsn uint64) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{f: f, path: path, lsn: lsn}
+	if err := l.readHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// readHeader reads the header of the file, writing it if the file is empty, and positions the log after it.
+func (l *Log) readHeader() error {
+	header := make([]byte, logHeaderSize)
+	n, err := io.ReadFull(l.f, header)
+	switch {
+	case n == 0 && err == io.EOF:
+		if _, err := l.f.Write(logHeader()); err != nil {
+			return err
+		}
+		if err := l.f.Sync(); err != nil {
+			return err
+		}
+	case err != nil && err != io.ErrUnexpectedEOF:
+		return err
+	case string(header[:n]) == string(logHeader()[:n]) && n < logHeaderSize:
+		// the header of a new log was only partially written, because of a crash
+		if err := writeAt(l.f, logHeader(), 0); err != nil {
+			return err
+		}
+	case string(header[:len(logMagic)]) == logMagic:
+		if version := header[len(logMagic)]; version != logVersion {
+			return fmt.Errorf("unknown log version: %d", version)
+		}
+	default:
+		return errors.New("not a log file")
+	}
+	l.size = int64(logHeaderSize)
+	_, err = l.f.Seek(l.size, io.SeekStart)
+	return err
+}
+
+// logHeader returns the header of a log file.
+func logHeader() []byte {
+	return append([]byte(logMagic), logVersion)
+}
+
+// writeAt writes data to the file at offset and syncs it.
+func writeAt(f *os.File, data []byte, offset int64) error {
+	if _, err := f.WriteAt(data, offset); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// append writes the record at the end of the log and syncs it.
+//
+// If the record cannot be written or synced it is removed from the file, so it is not replayed
+// after a restart and the next records are appended after the valid ones.
+// If even that fails, the log refuses all further appends.
+func (l *Log) append(r record) error {
+	if l.err != nil {
+		return &logError{"log failed", l.err}
+	}
+	r.lsn = l.lsn + 1
+	buf := r.encode(append(l.buf[:0], make([]byte, recordHeaderSize)...))
+	payload := buf[recordHeaderSize:]
+	if len(payload) > maxRecordSize {
+		return fmt.Errorf("record longer than %d bytes", maxRecordSize)
+	}
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	binary.LittleEndian.PutUint32(buf[8:12], crc32.Checksum(buf[0:8], crcTable))
+	l.buf = buf
+	if _, err := l.f.Write(buf); err != nil {
+		// do not leave a partial record behind us, the next one would be lost with it
+		l.undo()
+		return &logError{"writing log", err}
+	}
+	if err := l.f.Sync(); err != nil {
+		// the record may still reach the disk, and would then be replayed although the mutation failed
+		l.undo()
+		return &logError{"syncing log", err}
+	}
+	l.size += int64(len(buf))
+	l.lsn = r.lsn
+	return nil
+}
+
+// undo removes from the file whatever was written after the valid records.
+func (l *Log) undo() {
+	if err := l.f.Truncate(l.size); err != nil {
+		l.err = err
+		return
+	}
+	if err := l.f.Sync(); err != nil {
+		l.err = err
+		return
+	}
+	if _, err := l.f.Seek(l.size, io.SeekStart); err != nil {
+		l.err = err
+	}
+}
+
+// replay applies all records from the log to the scores,
+// and positions the log after the last valid record.
+//
+// Only a partially written last record is discarded, every other invalid record is an error.
+func (l *Log) replay(s *Scores) error {
+	r := bufio.NewReader(l.f)
+	header := make([]byte, recordHeaderSize)
+	var payload []byte
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if crc32.Checksum(header[0:8], crcTable) != binary.LittleEndian.Uint32(header[8:12]) {
+			// the blocks of a torn write which did not reach the disk are read as zeros
+			if zero, err := zeroTail(header, r); err != nil {
+				return err
+			} else if zero {
+				break
+			}
+			return fmt.Errorf("corrupted record at offset %d", l.size)
+		}
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size > maxRecordSize {
+			return fmt.Errorf("corrupted record at offset %d: length %d", l.size, size)
+		}
+		if cap(payload) < int(size) {
+			payload = make([]byte, size)
+		}
+		payload = payload[:size]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			// the length has a checksum, so the file really ends inside this record
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+			// a torn write can only be the last record, otherwise the log is corrupted
+			if _, err := r.Peek(1); err == io.EOF {
+				break
+			}
+			return fmt.Errorf("corrupted record at offset %d", l.size)
+		}
+		rec, err := decodeRecord(payload)
+		if err != nil {
+			return fmt.Errorf("record at offset %d: %w", l.size, err)
+		}
+		if rec.lsn > l.lsn {
+			// the records up to l.lsn are in the snapshot, which was written before compacting the log
+			for _, r := range rec.records() {
+				if r.at != 0 && s.ttl > 0 {
+					s.expireAt(r.at)
+				}
+				if err := s.validate(r); err != nil {
+					return fmt.Errorf("record at offset %d: %w", l.size, err)
+				}
+				s.commit(r)
+			}
+			l.lsn = rec.lsn
+		}
+		l.size += int64(recordHeaderSize + len(payload))
+	}
+	if err := l.f.Truncate(l.size); err != nil {
+		return err
+	}
+	_, err := l.f.Seek(l.size, io.SeekStart)
+	return err
+}
+
+// zeroTail returns whether the header and all bytes after it, up to the end of the file, are zeros.
+func zeroTail(header []byte, r *bufio.Reader) (bool, error) {
+	for _, b := range header {
+		if b != 0 {
+			return false, nil
+		}
+	}
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if b != 0 {
+			return false, nil
+		}
+	}
+}
+
+// compact removes the records before offset from the log.
+//
+// The remaining records are copied to a temporary file, which then replaces the log.
+func (l *Log) compact(offset int64) error {
+	tail := make([]byte, l.size-offset)
+	if _, err := l.f.ReadAt(tail, offset); err != nil {
+		return fmt.Errorf("reading log: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := writeFile(tmp, append(logHeader(), tail...)); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(l.path)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	l.f.Close()
+	l.f = f
+	l.size = int64(logHeaderSize + len(tail))
+	return nil
+}
+
+// encode appends the binary form of the record to buf.
+func (r record) encode(buf []byte) []byte {
+	buf = appendUvarint(buf, r.lsn)
+	buf = append(buf, byte(r.op))
+	if r.op == opBatch {
+		// every mutation is prefixed by its length, because of its optional fields
+		buf = appendUvarint(buf, uint64(len(r.batch)))
+		var sub []byte
+		for _, br := range r.batch {
+			sub = br.encode(sub[:0])
+			buf = appendUvarint(buf, uint64(len(sub)))
+			buf = append(buf, sub...)
+		}
+		return buf
+	}
+	buf = appendVarint(buf, int64(r.user))
+	buf = appendVarint(buf, int64(r.value))
+	// the optional fields are written only up to the last one which is set
+	if r.at != 0 || r.reason != "" || r.key != "" || r.seq != 0 {
+		buf = appendVarint(buf, r.at)
+	}
+	if r.reason != "" || r.key != "" || r.seq != 0 {
+		buf = appendString(buf, r.reason)
+	}
+	if r.key != "" || r.seq != 0 {
+		buf = appendString(buf, r.key)
+	}
+	if r.seq != 0 {
+		buf = appendUvarint(buf, r.seq)
+	}
+	return buf
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func appendString(buf []byte, v string) []byte {
+	buf = appendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+// decodeRecord decodes a record encoded with encode.
+func decodeRecord(buf []byte) (record, error) {
+	var r record
+	d := decoder{buf: buf}
+	r.lsn = d.uvarint()
+	r.op = op(d.byte())
+	if r.op == opBatch {
+		count := d.uvarint()
+		for i := uint64(0); i < count && d.err == nil; i++ {
+			br, err := decodeRecord([]byte(d.string()))
+			if err != nil {
+				return r, err
+			}
+			r.batch = append(r.batch, br)
+		}
+		return r, d.err
+	}
+	r.user = int(d.varint())
+	r.value = int(d.varint())
+	if len(d.buf) > 0 {
+		r.at = d.varint()
+	}
+	if len(d.buf) > 0 {
+		r.reason = d.string()
+	}
+	if len(d.buf) > 0 {
+		r.key = d.string()
+	}
+	if len(d.buf) > 0 {
+		r.seq = d.uvarint()
+	}
+	return r, d.err
+}
+
+// decoder decodes values from a buffer, remembering the first error.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errors.New("invalid uvarint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errors.New("invalid varint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	v := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+// writeFile writes data to a new file at path and syncs it.
+func writeFile(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs the directory, so the files created or renamed in it are durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
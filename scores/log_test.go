@@ -0,0 +1,201 @@
+package scores
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestLogReplay tests that reopening the log restores the scores.
+func TestLogReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sortedScores := generateScores(s)
+	if _, err := s.Update(Score{User: 3, Value: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(7); err != nil {
+		t.Fatal(err)
+	}
+	// a failed mutation must not be logged
+	if err := s.Add(Score{User: 8, Value: 1}); err == nil {
+		t.Fatalf("expected error for existing user")
+	}
+	expected := s.Top(len(sortedScores))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Score{User: 100, Value: 1}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got error for closed scores: %v, expected: %v", err, ErrClosed)
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if calculated := s.Top(len(sortedScores)); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got replayed scores: \n%v\n expected: \n%v\n", calculated, expected)
+	}
+	assertBalanced(t, s)
+}
+
+// TestLogFailed tests that mutations which cannot be written to the log are not applied, and fail with ErrLogFailed.
+func TestLogFailed(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "scores"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Score{User: 1, Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// neither the record nor its undo can be written anymore
+	s.log.f.Close()
+	for i := 0; i < 2; i++ {
+		if err := s.Add(Score{User: 2, Value: 1}); !errors.Is(err, ErrLogFailed) {
+			t.Fatalf("got error adding a score: %v, expected: %v", err, ErrLogFailed)
+		}
+	}
+	if _, _, err := s.RankOf(2); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("got error for the rank of a score which was not logged: %v, expected: %v", err, ErrUserNotFound)
+	}
+}
+
+// TestLogTruncated tests that a partially written last record is discarded,
+// and that the log can still be appended to afterwards.
+func TestLogTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Score{User: 1, Value: 10})
+	s.Add(Score{User: 2, Value: 20})
+	s.Close()
+	info, err := os.Stat(path + LogExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cut := range []int64{1, recordHeaderSize} {
+		if err := os.Truncate(path+LogExt, info.Size()-cut); err != nil {
+			t.Fatal(err)
+		}
+		s, err = Open(path)
+		if err != nil {
+			t.Fatalf("opening truncated log: %v", err)
+		}
+		if calculated, expected := s.Top(10), []Score{{1, 10}}; !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("got scores after truncation: %v, expected: %v", calculated, expected)
+		}
+		if err := s.Add(Score{User: 2, Value: 20}); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if calculated, expected := s.Top(10), []Score{{2, 20}, {1, 10}}; !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores after append: %v, expected: %v", calculated, expected)
+	}
+}
+
+// TestLogCorrupted tests that a corrupted record followed by other records is reported.
+func TestLogCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Score{User: 1, Value: 10})
+	s.Add(Score{User: 2, Value: 20})
+	s.Close()
+	data, err := os.ReadFile(path + LogExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[logHeaderSize+recordHeaderSize] ^= 0xff
+	if err := os.WriteFile(path+LogExt, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatalf("expected error for corrupted log")
+	}
+}
+
+// TestLogCorruptedLength tests that a record in the middle of the log with a corrupted length is reported,
+// instead of being discarded together with all records after it.
+func TestLogCorruptedLength(t *testing.T) {
+	for _, length := range []uint32{1 << 20, maxRecordSize + 1, 3} {
+		path := filepath.Join(t.TempDir(), "scores")
+		s, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var offsets []int64
+		for i := 1; i <= 5; i++ {
+			offsets = append(offsets, s.log.size)
+			s.Add(Score{User: i, Value: 10 * i})
+		}
+		s.Close()
+		data, err := os.ReadFile(path + LogExt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.LittleEndian.PutUint32(data[offsets[1]:], length)
+		if err := os.WriteFile(path+LogExt, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(path); err == nil {
+			t.Fatalf("expected error for corrupted length %d", length)
+		}
+		if info, err := os.Stat(path + LogExt); err != nil || info.Size() != int64(len(data)) {
+			t.Fatalf("got log of %v bytes, %v, expected: %d bytes", info.Size(), err, len(data))
+		}
+	}
+}
+
+// TestLogZeroTail tests that a last record whose blocks did not reach the disk, and are read as zeros, is discarded.
+func TestLogZeroTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Score{User: 1, Value: 10})
+	s.Close()
+	f, err := os.OpenFile(path+LogExt, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 100))
+	f.Close()
+	if s, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if calculated, expected := s.Top(10), []Score{{1, 10}}; !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores: %v, expected: %v", calculated, expected)
+	}
+}
+
+// TestLogHeader tests that files which are not logs of a known version are not opened.
+func TestLogHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	for _, data := range [][]byte{[]byte("scores\n"), append([]byte(logMagic), logVersion+1)} {
+		if err := os.WriteFile(path+LogExt, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if s, err := Open(path); err == nil {
+			s.Close()
+			t.Fatalf("expected error for log header %q", data)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package scores
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrVersionMismatch is returned when a mutation expects another version of the score of the user.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// MutationKind is what a mutation does.
+type MutationKind int
+
+const (
+	// MutationAdd adds the score of a new user.
+	MutationAdd MutationKind = iota + 1
+	// MutationUpdate adds a delta to the score of an existing user.
+	MutationUpdate
+	// MutationRemove removes a user and its score.
+	MutationRemove
+)
+
+// Mutation is a change of the scores, applied by Apply.
+type Mutation struct {
+	Kind   MutationKind
+	User   int
+	Value  int    // score of the added user, or delta of the updated one
+	Reason string // why the score changes, kept in the history of the user
+	Key    string // idempotency key, if the mutation must not be applied twice
+	// Version is the version the score of an updated or removed user must have,
+	// or 0 if the mutation does not depend on the current score.
+	Version uint64
+}
+
+// VersionedScore is a score together with its version.
+//
+// Every time the score of a user changes it gets a new version, greater than all previous ones,
+// even if the user is removed and added again.
+type VersionedScore struct {
+	Score
+	Version uint64
+}
+
+// Apply applies the mutation, returning the new score of the user with its version.
+//
+// A mutation with a version fails with ErrVersionMismatch if the score of the user changed since it had that version,
+// so writers can update a score they read without overwriting a concurrent update.
+func (s *Scores) Apply(m Mutation) (VersionedScore, error) {
+	r, err := m.record()
+	if err != nil {
+		return VersionedScore{}, err
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	return s.mutate(r)
+}
+
+// Lookup returns the score of the user, with its rank according to the rank mode of the scores, and its version.
+func (s *Scores) Lookup(user int) (RankedScore, uint64, error) {
+	v := s.current()
+	node, position, ok := v.find(user)
+	if !ok {
+		return RankedScore{}, 0, fmt.Errorf("%w: %d", ErrUserNotFound, user)
+	}
+	return RankedScore{Score: Score{User: node.user, Value: node.score}, Rank: v.rankOf(node, position, s.RankMode())}, node.seq, nil
+}
+
+// record returns the log record of the mutation.
+func (m Mutation) record() (record, error) {
+	r := record{user: m.User, value: m.Value, reason: m.Reason, key: m.Key, version: m.Version}
+	switch m.Kind {
+	case MutationAdd:
+		if m.Version != 0 {
+			return record{}, errors.New("added scores do not have a version")
+		}
+		r.op = opAdd
+	case MutationUpdate:
+		r.op = opUpdate
+	case MutationRemove:
+		r.op, r.value = opRemove, 0
+	default:
+		return record{}, fmt.Errorf("unknown mutation: %d", m.Kind)
+	}
+	return r, nil
+}
@@ -0,0 +1,50 @@
+package scores
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestApplyVersion tests that mutations expecting another version of the score fail,
+// and that versions grow with every change, also after removing and adding the user again.
+func TestApplyVersion(t *testing.T) {
+	s := New(WithDedup(10))
+	added, err := s.Apply(Mutation{Kind: MutationAdd, User: 1, Value: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := s.Apply(Mutation{Kind: MutationUpdate, User: 1, Value: 5, Version: added.Version, Key: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Value != 15 || updated.Version <= added.Version {
+		t.Fatalf("got updated score: %+v, after: %+v", updated, added)
+	}
+	// a retry returns the same result, even if the version changed since
+	if retried, err := s.Apply(Mutation{Kind: MutationUpdate, User: 1, Value: 5, Version: added.Version, Key: "a"}); err != nil || retried != updated {
+		t.Fatalf("got retried update: %+v %v, expected: %+v", retried, err, updated)
+	}
+	if _, err := s.Apply(Mutation{Kind: MutationUpdate, User: 1, Value: 5, Version: added.Version}); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("got error for stale version: %v, expected: %v", err, ErrVersionMismatch)
+	}
+	if _, err := s.Apply(Mutation{Kind: MutationRemove, User: 1, Version: added.Version}); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("got error for stale version: %v, expected: %v", err, ErrVersionMismatch)
+	}
+	// an update which does not change the score keeps its version
+	if unchanged, err := s.Apply(Mutation{Kind: MutationUpdate, User: 1, Version: updated.Version}); err != nil || unchanged != updated {
+		t.Fatalf("got unchanged score: %+v %v, expected: %+v", unchanged, err, updated)
+	}
+	if _, err := s.Apply(Mutation{Kind: MutationRemove, User: 1, Version: updated.Version}); err != nil {
+		t.Fatal(err)
+	}
+	readded, err := s.Apply(Mutation{Kind: MutationAdd, User: 1, Value: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readded.Version <= updated.Version {
+		t.Fatalf("got version %d after version %d", readded.Version, updated.Version)
+	}
+	if score, version, err := s.Lookup(1); err != nil || version != readded.Version || score.Rank != 1 {
+		t.Fatalf("got looked up score: %+v %d %v, expected: %+v", score, version, err, readded)
+	}
+}
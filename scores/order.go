@@ -0,0 +1,52 @@
+package scores
+
+import (
+	"fmt"
+)
+
+// Order decides whether higher or lower scores are better.
+type Order int
+
+const (
+	// Descending ranks higher scores first, as in most games.
+	Descending Order = iota
+	// Ascending ranks lower scores first, as in speedruns or golf.
+	Ascending
+)
+
+var orderNames = map[Order]string{
+	Descending: "desc",
+	Ascending:  "asc",
+}
+
+func (o Order) String() string {
+	if name, ok := orderNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Order(%d)", int(o))
+}
+
+// ParseOrder returns the order with the given name, as returned by String.
+//
+// The empty name is Descending.
+func ParseOrder(name string) (Order, error) {
+	if name == "" {
+		return Descending, nil
+	}
+	for o, oName := range orderNames {
+		if oName == name {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown order: %q", name)
+}
+
+// better returns whether score a is strictly better than score b.
+//
+// Better scores go to the right in our tree, so all traversals are the same for both orders.
+func (s *Scores) better(a, b int) bool {
+	if s.order == Ascending {
+		return a < b
+	}
+	return a > b
+}
@@ -0,0 +1,125 @@
+package scores
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+// Cursor is a position next to a score, for paging through the scores.
+//
+// Unlike a rank, a cursor keeps its place among the other scores when scores change,
+// so pages do not skip or repeat the scores which did not change.
+// It knows the direction of its page: Page returns the scores ranked after a forward cursor, from the one right after it,
+// and the scores ranked before a backward one, up to the one right before it.
+//
+// The zero cursor is a forward cursor before the best score.
+type Cursor struct {
+	set      bool // whether the cursor is next to the score below, or before the best score
+	backward bool
+	score    int
+	seq      uint64
+	user     int
+}
+
+// String returns the cursor as an opaque string, which can be parsed by ParseCursor.
+//
+// The zero cursor is the empty string.
+func (c Cursor) String() string {
+	if !c.set {
+		return ""
+	}
+	buf := make([]byte, 1+3*binary.MaxVarintLen64)
+	if c.backward {
+		buf[0] = 1
+	}
+	n := 1
+	n += binary.PutVarint(buf[n:], int64(c.score))
+	n += binary.PutUvarint(buf[n:], c.seq)
+	n += binary.PutVarint(buf[n:], int64(c.user))
+	return base64.RawURLEncoding.EncodeToString(buf[:n])
+}
+
+// ParseCursor parses a cursor returned by Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+	invalid := errors.New("invalid cursor")
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(buf) == 0 || buf[0] > 1 {
+		return Cursor{}, invalid
+	}
+	c := Cursor{set: true, backward: buf[0] == 1}
+	buf = buf[1:]
+	score, n := binary.Varint(buf)
+	if n <= 0 {
+		return Cursor{}, invalid
+	}
+	buf = buf[n:]
+	if c.seq, n = binary.Uvarint(buf); n <= 0 {
+		return Cursor{}, invalid
+	}
+	buf = buf[n:]
+	user, n := binary.Varint(buf)
+	if n <= 0 || n != len(buf) {
+		return Cursor{}, invalid
+	}
+	c.score, c.user = int(score), int(user)
+	return c, nil
+}
+
+// Page is a page of scores, from best to worst, annotated with their rank according to the rank mode of the scores.
+//
+// Prev is a backward cursor before the first score, and Next is a forward cursor after the last one.
+// They are zero if there are no scores before the first score, or after the last one.
+type Page struct {
+	Scores     []RankedScore
+	Prev, Next Cursor
+}
+
+// Page returns at most limit scores next to the cursor, in the direction of the cursor.
+func (s *Scores) Page(cursor Cursor, limit int) Page {
+	v := s.current()
+	if limit <= 0 || v.root == nil {
+		return Page{}
+	}
+	key := &Node{score: cursor.score, seq: cursor.seq, user: cursor.user}
+	// positions of the first and last scores of the page
+	var start, end int
+	if cursor.backward {
+		n := v.nextAbove(key)
+		if n == nil {
+			return Page{}
+		}
+		end = v.position(n)
+		start = end - limit + 1
+		if start < 1 {
+			start = 1
+		}
+	} else {
+		start = 1
+		if cursor.set {
+			n := v.nextBelow(key)
+			if n == nil {
+				return Page{}
+			}
+			start = v.position(n)
+		}
+		end = start + limit - 1
+		if end > v.len {
+			end = v.len
+		}
+	}
+	var scores []Score
+	v.root.search(1, start, end, &scores)
+	first, last := v.root.nodeAt(start), v.root.nodeAt(end)
+	page := Page{Scores: v.rank(scores, start, s.RankMode())}
+	if start > 1 {
+		page.Prev = Cursor{set: true, backward: true, score: first.score, seq: first.seq, user: first.user}
+	}
+	if end < v.len {
+		page.Next = Cursor{set: true, score: last.score, seq: last.seq, user: last.user}
+	}
+	return page
+}
@@ -0,0 +1,85 @@
+package scores
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestPage tests paging forward and backward through all the scores.
+func TestPage(t *testing.T) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for _, tieBreak := range []TieBreak{LastAchieverWins, FirstAchieverWins, LowerUserWins, SharedRank} {
+		s := New(WithTieBreak(tieBreak))
+		n := 103
+		for i := 0; i < n; i++ {
+			s.Add(Score{User: i, Value: random.Intn(20)})
+		}
+		expected := s.RangeRanked(n, n, s.RankMode())
+		var (
+			pages      []Page
+			calculated []RankedScore
+		)
+		for page := s.Page(Cursor{}, 10); ; page = s.Page(page.Next, 10) {
+			pages = append(pages, page)
+			calculated = append(calculated, page.Scores...)
+			if page.Next == (Cursor{}) {
+				break
+			}
+		}
+		if !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("%v: got pages: \n%v\n expected: \n%v\n", tieBreak, calculated, expected)
+		}
+		if len(pages) != 11 || pages[0].Prev != (Cursor{}) {
+			t.Fatalf("%v: got %d pages, first with previous cursor %v", tieBreak, len(pages), pages[0].Prev)
+		}
+		// paging back from the last page returns the same pages
+		for i := len(pages) - 1; i > 0; i-- {
+			cursor, err := ParseCursor(pages[i].Prev.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page := s.Page(cursor, 10); !reflect.DeepEqual(page, pages[i-1]) {
+				t.Fatalf("%v: got page %d: \n%v\n expected: \n%v\n", tieBreak, i-1, page, pages[i-1])
+			}
+		}
+	}
+}
+
+// TestPageChanging tests that pages do not skip or repeat scores when other scores change.
+func TestPageChanging(t *testing.T) {
+	s := New()
+	for i := 1; i <= 30; i++ {
+		s.Add(Score{User: i, Value: 10 * i})
+	}
+	page := s.Page(Cursor{}, 10)
+	// scores added and removed before the cursor would shift the ranks of the next page
+	s.Add(Score{User: 100, Value: 1000})
+	s.Add(Score{User: 101, Value: 295})
+	s.Remove(29)
+	page = s.Page(page.Next, 10)
+	var users []int
+	for _, score := range page.Scores {
+		users = append(users, score.User)
+	}
+	if expected := []int{20, 19, 18, 17, 16, 15, 14, 13, 12, 11}; !reflect.DeepEqual(users, expected) {
+		t.Fatalf("got users: %v, expected: %v", users, expected)
+	}
+	if page.Scores[0].Rank != 12 {
+		t.Fatalf("got rank %d, expected: 12", page.Scores[0].Rank)
+	}
+	page = s.Page(page.Prev, 10)
+	users = users[:0]
+	for _, score := range page.Scores {
+		users = append(users, score.User)
+	}
+	if expected := []int{101, 28, 27, 26, 25, 24, 23, 22, 21}; !reflect.DeepEqual(users[1:], expected) {
+		t.Fatalf("got users: %v, expected: %v", users, expected)
+	}
+	for _, invalid := range []string{"x", "AA", "AgIC", page.Next.String() + "A"} {
+		if _, err := ParseCursor(invalid); err == nil {
+			t.Fatalf("expected error for cursor %q", invalid)
+		}
+	}
+}
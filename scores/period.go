@@ -0,0 +1,85 @@
+package scores
+
+import (
+	"fmt"
+	"time"
+)
+
+// Period is the calendar period over which scores are ranked.
+type Period int
+
+const (
+	// AllTime is a single period that never ends.
+	AllTime Period = iota
+	// Daily periods start at midnight.
+	Daily
+	// Weekly periods start on Monday at midnight.
+	Weekly
+	// Monthly periods start on the first day of the month at midnight.
+	Monthly
+)
+
+var periodNames = map[Period]string{
+	AllTime: "all",
+	Daily:   "daily",
+	Weekly:  "weekly",
+	Monthly: "monthly",
+}
+
+func (p Period) String() string {
+	if name, ok := periodNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Period(%d)", int(p))
+}
+
+// ParsePeriod returns the period with the given name, as returned by String.
+//
+// The empty name is AllTime.
+func ParsePeriod(name string) (Period, error) {
+	if name == "" {
+		return AllTime, nil
+	}
+	for p, pName := range periodNames {
+		if pName == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown period: %q", name)
+}
+
+// Start returns the start of the period that contains t, in the location loc.
+//
+// The start of AllTime is the zero time.
+func (p Period) Start(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	switch p {
+	case Daily:
+	case Weekly:
+		day -= (int(t.Weekday()) + 6) % 7
+	case Monthly:
+		day = 1
+	default:
+		return time.Time{}
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// shift returns the start of the period which is n periods after the one starting at start.
+func (p Period) shift(start time.Time, n int) time.Time {
+	switch p {
+	case Daily:
+		return start.AddDate(0, 0, n)
+	case Weekly:
+		return start.AddDate(0, 0, 7*n)
+	case Monthly:
+		return start.AddDate(0, n, 0)
+	}
+	return start
+}
+
+// key identifies the period starting at start, in file names.
+func (p Period) key(start time.Time) string {
+	return p.String() + "." + start.Format("2006-01-02")
+}
@@ -0,0 +1,108 @@
+package scores
+
+import (
+	"fmt"
+)
+
+// RankMode decides how equal scores are ranked.
+type RankMode int
+
+const (
+	// OrdinalRank ranks every score by its position, as in "1234".
+	OrdinalRank RankMode = iota
+	// CompetitionRank gives equal scores the rank of the first of them, as in "1224".
+	CompetitionRank
+	// DenseRank gives equal scores the same rank, and the next worse score the next rank, as in "1223".
+	DenseRank
+)
+
+var rankModeNames = map[RankMode]string{
+	OrdinalRank:     "ordinal",
+	CompetitionRank: "competition",
+	DenseRank:       "dense",
+}
+
+func (m RankMode) String() string {
+	if name, ok := rankModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("RankMode(%d)", int(m))
+}
+
+// ParseRankMode returns the rank mode with the given name, as returned by String.
+//
+// The empty name is OrdinalRank.
+func ParseRankMode(name string) (RankMode, error) {
+	if name == "" {
+		return OrdinalRank, nil
+	}
+	for m, mName := range rankModeNames {
+		if mName == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown rank mode: %q", name)
+}
+
+// TopRanked returns top scores from best to worst, annotated with their rank according to mode.
+func (s *Scores) TopRanked(top int, mode RankMode) []RankedScore {
+	v := s.current()
+	return v.rank(v.cachedTop(top), 1, mode)
+}
+
+// RangeRanked returns scores ranked between position-size and position+size, if they exist,
+// annotated with their rank according to mode.
+//
+// Positions are ordinal ranks, whatever the mode.
+func (s *Scores) RangeRanked(position int, count int, mode RankMode) []RankedScore {
+	v := s.current()
+	if v.root == nil {
+		return nil
+	}
+	start := position - count
+	if start < 1 {
+		start = 1
+	}
+	return v.rank(v.root.Range(position, count), start, mode)
+}
+
+// RankMode returns the rank mode used by RankOf and AroundUser.
+//
+// It is the one set by WithRankMode, or CompetitionRank if the tie break is SharedRank.
+func (s *Scores) RankMode() RankMode {
+	if s.rankMode == OrdinalRank && s.tieBreak == SharedRank {
+		return CompetitionRank
+	}
+	return s.rankMode
+}
+
+// rankOf returns the rank of the node, according to the rank mode of the scores.
+//
+// The scores lock must be held, at least for reading.
+func (s *Scores) rankOf(n *Node) int {
+	v := s.working()
+	return v.rankOf(n, v.position(n), s.RankMode())
+}
+
+// rank annotates consecutive scores with their rank, according to mode, as by view.rank.
+//
+// countBetter and countDistinctBetter count the scores, and the distinct scores, strictly better than a value.
+func rank(scores []Score, start int, mode RankMode, countBetter, countDistinctBetter func(int) int) []RankedScore {
+	var ranked []RankedScore
+	for i, score := range scores {
+		rank := start + i
+		switch {
+		case mode == OrdinalRank:
+		case i > 0 && score.Value == scores[i-1].Value:
+			rank = ranked[i-1].Rank
+		case i > 0 && mode == DenseRank:
+			rank = ranked[i-1].Rank + 1
+		case i == 0 && mode == CompetitionRank:
+			rank = countBetter(score.Value) + 1
+		case i == 0 && mode == DenseRank:
+			rank = countDistinctBetter(score.Value) + 1
+		}
+		ranked = append(ranked, RankedScore{Score: score, Rank: rank})
+	}
+	return ranked
+}
@@ -2,77 +2,174 @@ package scores
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gadumitrachioaiei/gamescore/bintree2ascii"
 )
 
+// ErrUserNotFound is returned when we do not have a score for the user.
+var ErrUserNotFound = errors.New("user cannot be found")
+
+// ErrClosed is returned when changing scores which are closed.
+var ErrClosed = errors.New("scores are closed")
+
 // Scores stores scores for our game and can answer queries about them.
 //
-// We store scores in a BST, with some additional metadata, so we can rank the scores.
+// We store scores in a self balancing BST, with some additional metadata, so we can rank the scores.
+// Better scores go to the right, so the best score is the rightmost one.
+// Every operation is O(log n), regardless of the order in which scores arrive.
 //
-// Thread safe.
+// Thread safe. Mutations copy the nodes they change instead of changing them, and publish the new version
+// of the tree when they are done, so queries read the published version without taking the lock,
+// and neither wait for mutations nor make them wait.
 type Scores struct {
-	mu    sync.Mutex
-	root  *Node
-	users map[int]*Node // map users to their node in the tree
+	mu           sync.RWMutex // mutations hold it for writing, History and the queries of Sharded for reading
+	root         *Node
+	users        map[int]*Node // map users to their node in the tree
+	userIndex    *userNode     // index of the users, for queries of published versions of the tree
+	published    atomic.Value  // *view with the version of the scores read by queries
+	gen          uint64        // generation of the nodes created since the last publish
+	changed      bool          // whether the tree changed since the last publish
+	seq          uint64        // sequence number of the last achieved score, for breaking ties
+	order        Order
+	tieBreak     TieBreak
+	rankMode     RankMode
+	ttl          time.Duration          // if positive, scores expire after it
+	now          func() time.Time       // current time, for expiring scores
+	expiry       expiryHeap             // nodes by the time they were achieved at, if scores expire
+	history      map[int][]HistoryEntry // changes of the scores of every user, if kept
+	historyLimit int                    // how many changes of every user are kept, DefaultHistoryLimit if not positive
+	dedup        *dedupTable            // results of the last mutations with idempotency keys, if kept
+	top          *topCache              // best scores, so the most frequent queries do not walk the tree
+	sequence     *uint64                // if not nil, the last sequence number of all the shards of Sharded
+	log          *Log                   // if not nil, mutations are appended to it before being applied
+	path         string                 // path of the log and snapshot files, without extension
+	lsn          uint64                 // sequence number of the last record of the log, after closing it
+	closed       bool
+
+	checkpointMu sync.Mutex // serializes checkpoints, and closing with them
+}
+
+// Option configures the scores.
+type Option func(*Scores)
+
+// WithOrder sets whether higher or lower scores are better, by default Descending.
+func WithOrder(o Order) Option {
+	return func(s *Scores) {
+		s.order = o
+	}
+}
+
+// WithTieBreak sets how users with equal scores are ranked, by default LastAchieverWins.
+func WithTieBreak(t TieBreak) Option {
+	return func(s *Scores) {
+		s.tieBreak = t
+	}
+}
+
+// WithRankMode sets how equal scores are ranked by RankOf and AroundUser, by default OrdinalRank.
+func WithRankMode(m RankMode) Option {
+	return func(s *Scores) {
+		s.rankMode = m
+	}
 }
 
 // New returns a new Scores object
-func New() *Scores {
-	return &Scores{users: make(map[int]*Node)}
+func New(options ...Option) *Scores {
+	s := &Scores{users: make(map[int]*Node), now: time.Now, top: newTopCache()}
+	for _, option := range options {
+		option(s)
+	}
+	s.changed = true
+	s.publish()
+	return s
 }
 
 // Add adds a new score for the user in the s tree
 func (s *Scores) Add(score Score) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.users[score.User]; ok {
-		return fmt.Errorf("Existing user: %d", score.User)
-	}
-	if s.root == nil {
-		s.root = &Node{
-			score: score.Value,
-			user:  score.User,
-		}
-		s.users[score.User] = s.root
-		return nil
-	}
-	s.users[score.User] = s.root.Add(score)
-	return nil
+	defer s.unlock()
+	_, err := s.mutate(record{op: opAdd, user: score.User, value: score.Value})
+	return err
 }
 
-// Top returns top scores in descending order.
+// Top returns top scores from best to worst, which is descending order unless the scores are Ascending.
 func (s *Scores) Top(top int) []Score {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.root == nil {
-		return nil
-	}
-	return s.root.Top(top)
+	return s.current().cachedTop(top)
 }
 
 // Range returns scores ranked between position-size and position+size, if they exist.
 //
-// The scores are sorted in descending order.
+// The scores are sorted from best to worst.
 func (s *Scores) Range(position int, count int) []Score {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.root == nil {
+	v := s.current()
+	if v.root == nil {
 		return nil
 	}
-	return s.root.Range(position, count)
+	return v.root.Range(position, count)
+}
+
+// RankOf returns the rank of the user, starting from 1, together with its score.
+//
+// The rank is calculated according to the rank mode of the scores.
+func (s *Scores) RankOf(user int) (int, Score, error) {
+	v := s.current()
+	node, position, ok := v.find(user)
+	if !ok {
+		return 0, Score{}, fmt.Errorf("%w: %d", ErrUserNotFound, user)
+	}
+	return v.rankOf(node, position, s.RankMode()), Score{User: node.user, Value: node.score}, nil
+}
+
+// PositionOf returns the ordinal rank of the user, starting from 1, whatever the rank mode of the scores.
+func (s *Scores) PositionOf(user int) (int, error) {
+	v := s.current()
+	_, position, ok := v.find(user)
+	if !ok {
+		return 0, fmt.Errorf("%w: %d", ErrUserNotFound, user)
+	}
+	return position, nil
+}
+
+// AroundUser returns the scores ranked between rank-count and rank+count, where rank is the rank of the user.
+//
+// The scores are sorted from best to worst and are annotated with their rank, according to the rank mode of the scores.
+func (s *Scores) AroundUser(user int, count int) ([]RankedScore, error) {
+	v := s.current()
+	_, position, ok := v.find(user)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUserNotFound, user)
+	}
+	start := position - count
+	if start < 1 {
+		start = 1
+	}
+	return v.rank(v.root.Range(position, count), start, s.RankMode()), nil
+}
+
+// Len returns the number of users that have a score.
+func (s *Scores) Len() int {
+	return s.current().len
 }
 
 // Node is a node for our scores tree.
 type Node struct {
-	score        int   // score of the user, used as key in our tree
-	user         int   // user that had the above score, used as value in our tree
-	left, right  *Node // left and right children
-	lsize, rsize int   // left and right subtree size
-	parent       *Node // we need this so we can walk the tree upwards
+	score        int    // score of the user, used as key in our tree
+	user         int    // user that had the above score, used as value in our tree
+	left, right  *Node  // left and right children
+	lsize, rsize int    // left and right subtree size
+	height       int    // height of the subtree rooted at this node, used for balancing
+	seq          uint64 // when the user achieved the score, used for breaking ties
+	at           int64  // when the user achieved the score, as unix nanoseconds, if scores expire
+	index        int    // index of the node in the expiry heap, if scores expire
+	gen          uint64 // generation of the scores when the node was created, see Scores.own
+	// scores of the leftmost and rightmost nodes and number of distinct scores in the subtree
+	leftmost, rightmost, distinct int
 }
 
 // Score represents a score, to be added or returned from our tree.
@@ -81,6 +178,12 @@ type Score struct {
 	Value int
 }
 
+// RankedScore is a score together with its rank, starting from 1.
+type RankedScore struct {
+	Score
+	Rank int
+}
+
 func (s *Node) MarshalJSON() ([]byte, error) {
 	type TreeNode struct {
 		Name      string    `json:"name"`
@@ -145,19 +248,9 @@ func edgeToDot(n1, n2 *Node) string {
 	return fmt.Sprintf(`"s%du%d" -> "s%du%d"[label="%d"]; `, n1.score, n1.user, n2.score, n2.user, label)
 }
 
-// Add adds a new score for the user in the s tree.
-func (s *Node) Add(score Score) *Node {
-	if score.Value < s.score {
-		s.lsize++
-		return s.left.add(score, s)
-	}
-	s.rsize++
-	return s.right.add(score, s)
-}
-
-// Top returns top scores, in descending order.
+// Top returns top scores, from best to worst.
 //
-// If we have equal scores, the later ones are ranked higher.
+// Equal scores are ordered by the tie break of the scores.
 func (s *Node) Top(top int) []Score {
 	if top <= 0 {
 		return nil
@@ -180,7 +273,7 @@ func (s *Node) Top(top int) []Score {
 
 // Range returns root ranked between position-size and position+size, if they exist.
 //
-// The root are sorted in descending order. If we have equal scores, the later ones are ranked higher.
+// The root are sorted from best to worst. Equal scores are ordered by the tie break of the scores.
 func (s *Node) Range(position int, size int) []Score {
 	var scores []Score
 	s.search(1, position-size, position+size, &scores)
@@ -239,24 +332,6 @@ func (s *Node) inOrderReverse(users *[]Score) {
 	}
 }
 
-// add adds a new score in the s tree, or attached directly to the parent
-func (s *Node) add(score Score, parent *Node) *Node {
-	if s != nil {
-		return s.Add(score)
-	}
-	newScore := &Node{
-		score:  score.Value,
-		user:   score.User,
-		parent: parent,
-	}
-	if score.Value < parent.score {
-		parent.left = newScore
-	} else {
-		parent.right = newScore
-	}
-	return newScore
-}
-
 // intersection returns the intersection between two intervals.
 func intersection(s1, e1, s2, e2 int) (int, int) {
 	if e1 < s2 || e2 < s1 {
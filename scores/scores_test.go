@@ -1,11 +1,14 @@
 package scores
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os/exec"
 	"reflect"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 )
@@ -99,6 +102,383 @@ func TestScoresTopRandom(t *testing.T) {
 	}
 }
 
+// TestScoresRankOf tests that the rank of every user matches its position in the sorted scores.
+func TestScoresRankOf(t *testing.T) {
+	s := New()
+	scores, sortedScores := generateScores(s)
+	for i, expected := range sortedScores {
+		rank, score, err := s.RankOf(expected.User)
+		if err != nil {
+			t.Fatalf("getting rank of existing user: %v", err)
+		}
+		if rank != i+1 || score != expected {
+			t.Fatalf("got rank %d and score %v, expected: %d and %v, scores: %v", rank, score, i+1, expected, scores)
+		}
+	}
+	if _, _, err := s.RankOf(len(scores)); err == nil {
+		t.Fatalf("expected error for missing user")
+	}
+}
+
+// TestScoresPositionOf tests that positions are ordinal ranks, whatever the rank mode.
+func TestScoresPositionOf(t *testing.T) {
+	for _, s := range []Leaderboard{New(WithRankMode(DenseRank)), NewSharded(3, WithRankMode(DenseRank))} {
+		for user, value := range []int{20, 10, 10, 5} {
+			if err := s.Add(Score{User: user + 1, Value: value}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i, score := range s.Top(10) {
+			position, err := s.PositionOf(score.User)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if position != i+1 {
+				t.Fatalf("got position of %v: %d, expected: %d", score, position, i+1)
+			}
+		}
+		if _, err := s.PositionOf(5); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("got error for missing user: %v, expected: %v", err, ErrUserNotFound)
+		}
+	}
+}
+
+// TestScoresAroundUser tests that the window around every user matches the sorted scores.
+func TestScoresAroundUser(t *testing.T) {
+	s := New()
+	scores, sortedScores := generateScores(s)
+	count := 2
+	for i, score := range sortedScores {
+		start, end := i-count, i+count+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(sortedScores) {
+			end = len(sortedScores)
+		}
+		var expected []RankedScore
+		for j := start; j < end; j++ {
+			expected = append(expected, RankedScore{Score: sortedScores[j], Rank: j + 1})
+		}
+		calculated, err := s.AroundUser(score.User, count)
+		if err != nil {
+			t.Fatalf("getting scores around existing user: %v", err)
+		}
+		if !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("got scores around user %d: \n%v\n expected: \n%v\n scores:\n%v\n", score.User, calculated, expected, scores)
+		}
+	}
+}
+
+// TestScoresRemove tests removing users, including the root, keeps the tree balanced and sorted.
+func TestScoresRemove(t *testing.T) {
+	s := New()
+	var scores []Score
+	for i := 0; i < 100; i++ {
+		score := Score{User: i, Value: i % 7}
+		scores = append(scores, score)
+		s.Add(score)
+	}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for len(scores) > 0 {
+		i := random.Intn(len(scores))
+		if len(scores)%3 == 0 {
+			// remove the root every now and then
+			for j, score := range scores {
+				if score.User == s.root.user {
+					i = j
+				}
+			}
+		}
+		if err := s.Remove(scores[i].User); err != nil {
+			t.Fatalf("removing existing user: %v", err)
+		}
+		if _, _, err := s.RankOf(scores[i].User); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("got error %v for removed user, expected: %v", err, ErrUserNotFound)
+		}
+		scores = append(scores[:i], scores[i+1:]...)
+		assertBalanced(t, s)
+		if len(scores) > 0 {
+			assertBST(t, s, sortScores(scores))
+		}
+	}
+	if s.root != nil {
+		t.Fatalf("got root %s after removing all users", s.root.Key())
+	}
+	if err := s.Remove(1); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("got error %v for missing user, expected: %v", err, ErrUserNotFound)
+	}
+}
+
+// TestScoresPublished tests that a published version of the scores does not change when the scores change.
+func TestScoresPublished(t *testing.T) {
+	s := New()
+	for i := 0; i < 100; i++ {
+		s.Add(Score{User: i, Value: i % 7})
+	}
+	v := s.current()
+	scores := v.root.Top(v.len)
+	positions := make(map[int]int)
+	for user := 0; user < 100; user++ {
+		_, position, _ := v.find(user)
+		positions[user] = position
+	}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 300; i++ {
+		user := random.Intn(150)
+		switch random.Intn(3) {
+		case 0:
+			s.Add(Score{User: user, Value: random.Intn(20)})
+		case 1:
+			s.Update(Score{User: user, Value: random.Intn(20) - 10})
+		default:
+			s.Remove(user)
+		}
+	}
+	assertBalanced(t, s)
+	if got := v.root.Top(v.len); !reflect.DeepEqual(got, scores) {
+		t.Fatalf("got published scores:\n%v\n, expected:\n%v\n", got, scores)
+	}
+	for user, position := range positions {
+		node, found, ok := v.find(user)
+		if !ok || found != position || v.position(node) != position {
+			t.Fatalf("user %d is not at the published position %d", user, position)
+		}
+	}
+}
+
+// TestTieBreak tests the ranking of equal scores, for every tie break.
+func TestTieBreak(t *testing.T) {
+	type testCase struct {
+		tieBreak TieBreak
+		expected []RankedScore
+	}
+	// user 3 reaches 10 first, then users 1 and 4, then user 2 after an update
+	testCases := []testCase{
+		{
+			tieBreak: LastAchieverWins,
+			expected: []RankedScore{{Score{5, 20}, 1}, {Score{2, 10}, 2}, {Score{4, 10}, 3}, {Score{1, 10}, 4}, {Score{3, 10}, 5}},
+		},
+		{
+			tieBreak: FirstAchieverWins,
+			expected: []RankedScore{{Score{5, 20}, 1}, {Score{3, 10}, 2}, {Score{1, 10}, 3}, {Score{4, 10}, 4}, {Score{2, 10}, 5}},
+		},
+		{
+			tieBreak: LowerUserWins,
+			expected: []RankedScore{{Score{5, 20}, 1}, {Score{1, 10}, 2}, {Score{2, 10}, 3}, {Score{3, 10}, 4}, {Score{4, 10}, 5}},
+		},
+		{
+			tieBreak: SharedRank,
+			expected: []RankedScore{{Score{5, 20}, 1}, {Score{1, 10}, 2}, {Score{2, 10}, 2}, {Score{3, 10}, 2}, {Score{4, 10}, 2}},
+		},
+	}
+	for _, tc := range testCases {
+		s := New(WithTieBreak(tc.tieBreak))
+		s.Add(Score{User: 3, Value: 10})
+		s.Add(Score{User: 2, Value: 5})
+		s.Add(Score{User: 1, Value: 10})
+		s.Add(Score{User: 4, Value: 10})
+		s.Add(Score{User: 5, Value: 20})
+		s.Update(Score{User: 2, Value: 5})
+		// updating with zero does not change the order
+		s.Update(Score{User: 3, Value: 0})
+		var expectedScores []Score
+		for _, ranked := range tc.expected {
+			expectedScores = append(expectedScores, ranked.Score)
+		}
+		if calculated := s.Top(10); !reflect.DeepEqual(calculated, expectedScores) {
+			t.Fatalf("%v: got top scores: %v, expected: %v", tc.tieBreak, calculated, expectedScores)
+		}
+		for _, expected := range tc.expected {
+			if rank, _, _ := s.RankOf(expected.User); rank != expected.Rank {
+				t.Fatalf("%v: got rank %d for user %d, expected: %d", tc.tieBreak, rank, expected.User, expected.Rank)
+			}
+		}
+		if calculated, _ := s.AroundUser(tc.expected[4].User, 3); !reflect.DeepEqual(calculated, tc.expected[1:]) {
+			t.Fatalf("%v: got scores around user: %v, expected: %v", tc.tieBreak, calculated, tc.expected[1:])
+		}
+		var buf bytes.Buffer
+		s.Snapshot(&buf)
+		restored, err := Restore(&buf, WithTieBreak(tc.tieBreak))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calculated := restored.Top(10); !reflect.DeepEqual(calculated, expectedScores) {
+			t.Fatalf("%v: got restored top scores: %v, expected: %v", tc.tieBreak, calculated, expectedScores)
+		}
+	}
+}
+
+// TestRankModes tests ranks of random scores with many equal ones, for every rank mode.
+func TestRankModes(t *testing.T) {
+	s := New()
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var scores []Score
+	for i := 0; i < 200; i++ {
+		score := Score{User: i, Value: random.Intn(30)}
+		scores = append(scores, score)
+		s.Add(score)
+	}
+	sortedScores := sortScores(scores)
+	expected := map[RankMode][]RankedScore{}
+	for i, score := range sortedScores {
+		ordinal := RankedScore{Score: score, Rank: i + 1}
+		competition, dense := ordinal, ordinal
+		if i > 0 && score.Value == sortedScores[i-1].Value {
+			competition.Rank = expected[CompetitionRank][i-1].Rank
+			dense.Rank = expected[DenseRank][i-1].Rank
+		} else if i > 0 {
+			dense.Rank = expected[DenseRank][i-1].Rank + 1
+		}
+		expected[OrdinalRank] = append(expected[OrdinalRank], ordinal)
+		expected[CompetitionRank] = append(expected[CompetitionRank], competition)
+		expected[DenseRank] = append(expected[DenseRank], dense)
+	}
+	for mode, ranked := range expected {
+		if calculated := s.TopRanked(len(ranked), mode); !reflect.DeepEqual(calculated, ranked) {
+			t.Fatalf("%v: got top scores: \n%v\n expected: \n%v\n", mode, calculated, ranked)
+		}
+		for position := 1; position <= len(ranked); position += 7 {
+			start, end := position-3, position+4
+			if start < 1 {
+				start = 1
+			}
+			if end > len(ranked)+1 {
+				end = len(ranked) + 1
+			}
+			if calculated := s.RangeRanked(position, 3, mode); !reflect.DeepEqual(calculated, ranked[start-1:end-1]) {
+				t.Fatalf("%v: got range around %d: \n%v\n expected: \n%v\n", mode, position, calculated, ranked[start-1:end-1])
+			}
+		}
+		ranks := New(WithRankMode(mode))
+		for _, score := range scores {
+			ranks.Add(score)
+		}
+		for _, expected := range ranked {
+			if rank, _, _ := ranks.RankOf(expected.User); rank != expected.Rank {
+				t.Fatalf("%v: got rank %d for user %d, expected: %d", mode, rank, expected.User, expected.Rank)
+			}
+		}
+	}
+}
+
+// TestAscending tests that lower scores are ranked first in ascending scores.
+func TestAscending(t *testing.T) {
+	s := New(WithOrder(Ascending))
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var scores []Score
+	for i := 0; i < 100; i++ {
+		score := Score{User: i, Value: random.Intn(20)}
+		scores = append(scores, score)
+		s.Add(score)
+	}
+	for i := 0; i < 100; i++ {
+		score := Score{User: random.Intn(len(scores)), Value: random.Intn(5) - 2}
+		scores = updateScores(scores, score)
+		s.Update(score)
+	}
+	// negating the values sorts them in ascending order
+	negated := make([]Score, len(scores))
+	for i, score := range scores {
+		negated[i] = Score{User: score.User, Value: -score.Value}
+	}
+	var expected []Score
+	for _, score := range sortScores(negated) {
+		expected = append(expected, Score{User: score.User, Value: -score.Value})
+	}
+	if calculated := s.Top(len(expected)); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got top scores: \n%v\n expected: \n%v\n", calculated, expected)
+	}
+	if calculated := s.Range(50, 2); !reflect.DeepEqual(calculated, expected[47:52]) {
+		t.Fatalf("got range scores: \n%v\n expected: \n%v\n", calculated, expected[47:52])
+	}
+	for i, score := range expected {
+		if rank, _, _ := s.RankOf(score.User); rank != i+1 {
+			t.Fatalf("got rank %d for user %d, expected: %d", rank, score.User, i+1)
+		}
+	}
+	ranked := s.TopRanked(len(expected), DenseRank)
+	for i := 1; i < len(ranked); i++ {
+		if ranked[i].Value == ranked[i-1].Value && ranked[i].Rank != ranked[i-1].Rank ||
+			ranked[i].Value != ranked[i-1].Value && ranked[i].Rank != ranked[i-1].Rank+1 {
+			t.Fatalf("got dense ranks: %v", ranked)
+		}
+	}
+	if ranked[0].Rank != 1 {
+		t.Fatalf("got dense ranks: %v", ranked)
+	}
+	if rank := s.current().countDistinctBetter(ranked[len(ranked)-1].Value) + 1; rank != ranked[len(ranked)-1].Rank {
+		t.Fatalf("got dense rank %d of the worst score, expected: %d", rank, ranked[len(ranked)-1].Rank)
+	}
+}
+
+// TestSubmit tests submitting scores with every policy.
+func TestSubmit(t *testing.T) {
+	type step struct {
+		user, value int
+		policy      SubmitPolicy
+		expected    Submission
+	}
+	for _, order := range []Order{Descending, Ascending} {
+		s := New(WithOrder(order))
+		s.Add(Score{User: 1, Value: 50})
+		// the better score, for the order of the scores
+		better := func(a, b int) int {
+			if order == Ascending {
+				return b
+			}
+			return a
+		}
+		steps := []step{
+			{2, 40, KeepBest, Submission{Score{2, 40}, better(2, 1), 0, true, 0}},
+			{2, 30, KeepBest, Submission{Score{2, better(40, 30)}, better(2, 1), better(2, 1), false, 0}},
+			{2, 60, KeepBest, Submission{Score{2, better(60, 30)}, 1, better(2, 1), false, 0}},
+			{2, 45, KeepLatest, Submission{Score{2, 45}, better(2, 1), 1, false, 0}},
+			{2, 10, Accumulate, Submission{Score{2, 55}, better(1, 2), better(2, 1), false, 0}},
+			{3, 5, Accumulate, Submission{Score{3, 5}, better(3, 1), 0, true, 0}},
+		}
+		var version uint64
+		for _, step := range steps {
+			sub, err := s.Submit(step.user, step.value, step.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sub.Version < version {
+				t.Fatalf("%v: got version %d after version %d", order, sub.Version, version)
+			}
+			version, sub.Version = sub.Version, 0
+			if sub != step.expected {
+				t.Fatalf("%v: got submission %+v for %d %v, expected: %+v", order, sub, step.value, step.policy, step.expected)
+			}
+		}
+		assertBalanced(t, s)
+	}
+}
+
+// TestScoresSortedInput tests that the tree stays balanced when scores arrive in sorted order,
+// and after updating them.
+func TestScoresSortedInput(t *testing.T) {
+	s := New()
+	var scores []Score
+	for i := 0; i < 1000; i++ {
+		score := Score{User: i, Value: i}
+		scores = append(scores, score)
+		s.Add(score)
+	}
+	assertBalanced(t, s)
+	assertBST(t, s, sortScores(scores))
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 1000; i++ {
+		score := Score{User: random.Intn(len(scores)), Value: random.Intn(21) - 10}
+		scores = updateScores(scores, score)
+		if _, err := s.Update(score); err != nil {
+			t.Fatalf("updating existing user: %v", err)
+		}
+	}
+	assertBalanced(t, s)
+	assertBST(t, s, sortScores(scores))
+}
+
 func TestUpdateRoot(t *testing.T) {
 	s := New()
 	s.Add(Score{User: 1, Value: 2})
@@ -154,6 +534,22 @@ func updateSortedScores(scores []Score, newScore Score) []Score {
 	return sortScores(scores)
 }
 
+// updateScores applies the update to scores, which are in insertion order,
+// moving the updated score to the end, as it becomes the latest one.
+func updateScores(scores []Score, update Score) []Score {
+	if update.Value == 0 {
+		return scores
+	}
+	for i := 0; i < len(scores); i++ {
+		if scores[i].User == update.User {
+			update.Value += scores[i].Value
+			scores = append(scores[:i], scores[i+1:]...)
+			break
+		}
+	}
+	return append(scores, update)
+}
+
 // generateScores attaches 10 random scores to the tree and returns them together with a sorted copy.
 func generateScores(t *Scores) ([]Score, []Score) {
 	random := rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -199,6 +595,57 @@ func assertBST(t *testing.T, s *Scores, sortedScores []Score) {
 	}
 }
 
+// assertBalanced asserts that the tree is an AVL tree with correct metadata,
+// and that it is published together with the index of its users.
+func assertBalanced(t *testing.T, s *Scores) {
+	var check func(n *Node) (size, height int)
+	check = func(n *Node) (int, int) {
+		if n == nil {
+			return 0, 0
+		}
+		lsize, lheight := check(n.left)
+		rsize, rheight := check(n.right)
+		if n.lsize != lsize || n.rsize != rsize {
+			t.Fatalf("node %s has sizes %d %d, expected: %d %d", n.Key(), n.lsize, n.rsize, lsize, rsize)
+		}
+		height := 1 + max(lheight, rheight)
+		if n.height != height {
+			t.Fatalf("node %s has height %d, expected: %d", n.Key(), n.height, height)
+		}
+		if n.distinct != len(distinctScores(inOrder(n))) {
+			t.Fatalf("node %s has %d distinct scores, expected: %d", n.Key(), n.distinct, len(distinctScores(inOrder(n))))
+		}
+		if lheight-rheight > 1 || rheight-lheight > 1 {
+			t.Fatalf("node %s is unbalanced: %d %d", n.Key(), lheight, rheight)
+		}
+		return lsize + rsize + 1, height
+	}
+	if size, _ := check(s.root); size != len(s.users) {
+		t.Fatalf("got tree size %d, expected: %d", size, len(s.users))
+	}
+	v := s.current()
+	if v.root != s.root || v.len != len(s.users) {
+		t.Fatalf("the tree is not published")
+	}
+	for user, node := range s.users {
+		if node.user != user {
+			t.Fatalf("user %d is mapped to node %s", user, node.Key())
+		}
+		if found, _, ok := v.find(user); !ok || found != node {
+			t.Fatalf("user %d is not indexed", user)
+		}
+	}
+}
+
+// distinctScores returns the distinct values of the scores.
+func distinctScores(scores []Score) map[int]bool {
+	distinct := make(map[int]bool)
+	for _, score := range scores {
+		distinct[score.Value] = true
+	}
+	return distinct
+}
+
 func inOrder(node *Node) []Score {
 	if node == nil {
 		return nil
@@ -208,3 +655,175 @@ func inOrder(node *Node) []Score {
 	scores = append(scores, inOrder(node.left)...)
 	return scores
 }
+
+// benchmarkSizes are the tree sizes used by benchmarks, so we can see how the operations scale.
+var benchmarkSizes = []int{1000, 10000, 100000, 1000000}
+
+// sortedScores returns a tree with n scores that were added in ascending order.
+func sortedScores(n int) *Scores {
+	s := New()
+	for i := 0; i < n; i++ {
+		s.Add(Score{User: i, Value: i})
+	}
+	return s
+}
+
+func BenchmarkAddSorted(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			s := sortedScores(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Add(Score{User: n + i, Value: n + i})
+			}
+		})
+	}
+}
+
+func BenchmarkUpdateSorted(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			s := sortedScores(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Update(Score{User: i % n, Value: 1})
+			}
+		})
+	}
+}
+
+func BenchmarkTopSorted(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			s := sortedScores(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Top(10)
+			}
+		})
+	}
+}
+
+func BenchmarkRangeSorted(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			s := sortedScores(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Range(n/2, 5)
+			}
+		})
+	}
+}
+
+// benchmarkScores are the operations of the parallel benchmarks.
+type benchmarkScores interface {
+	Update(score Score) (Score, error)
+	Range(position int, count int) []Score
+	RankOf(user int) (int, Score, error)
+}
+
+// mutexScores serializes all operations of the scores, queries included, with a mutex,
+// as a baseline for the parallel benchmarks of queries which read published versions of the scores without locks.
+type mutexScores struct {
+	mu sync.Mutex
+	s  *Scores
+}
+
+func (m *mutexScores) Update(score Score) (Score, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.s.Update(score)
+}
+
+func (m *mutexScores) Range(position int, count int) []Score {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.s.Range(position, count)
+}
+
+func (m *mutexScores) RankOf(user int) (int, Score, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.s.RankOf(user)
+}
+
+// runParallel runs the benchmark with new scores, and with other new scores behind a mutex as a baseline,
+// so each run starts from the same scores.
+func runParallel(b *testing.B, scores func() *Scores, benchmark func(b *testing.B, s benchmarkScores)) {
+	b.Run("lock=none", func(b *testing.B) {
+		s := scores()
+		b.ResetTimer()
+		benchmark(b, s)
+	})
+	b.Run("lock=mutex", func(b *testing.B) {
+		s := &mutexScores{s: scores()}
+		b.ResetTimer()
+		benchmark(b, s)
+	})
+}
+
+// query runs a rank or a range query, which are not served from the cached top scores, so they walk the tree.
+func query(s benchmarkScores, random *rand.Rand, n int) {
+	if random.Intn(2) == 0 {
+		s.RankOf(random.Intn(n))
+		return
+	}
+	s.Range(random.Intn(n)+1, 10)
+}
+
+// BenchmarkParallelQueries measures the throughput of concurrent rank and range queries.
+func BenchmarkParallelQueries(b *testing.B) {
+	n := 100000
+	runParallel(b, func() *Scores { return sortedScores(n) }, func(b *testing.B, s benchmarkScores) {
+		b.RunParallel(func(pb *testing.PB) {
+			random := rand.New(rand.NewSource(time.Now().UnixNano()))
+			for pb.Next() {
+				query(s, random, n)
+			}
+		})
+	})
+}
+
+// BenchmarkParallelMixed measures the throughput of concurrent queries and updates,
+// with 50 queries for every update, which is the usual ratio of a busy leaderboard.
+func BenchmarkParallelMixed(b *testing.B) {
+	n := 100000
+	runParallel(b, func() *Scores { return sortedScores(n) }, func(b *testing.B, s benchmarkScores) {
+		b.RunParallel(func(pb *testing.PB) {
+			random := rand.New(rand.NewSource(time.Now().UnixNano()))
+			for i := 0; pb.Next(); i++ {
+				if i%51 == 0 {
+					s.Update(Score{User: random.Intn(n), Value: 1})
+					continue
+				}
+				query(s, random, n)
+			}
+		})
+	})
+}
+
+// BenchmarkParallelMixedExpiry is BenchmarkParallelMixed with scores that expire,
+// so queries must check whether some scores expired before reading.
+func BenchmarkParallelMixedExpiry(b *testing.B) {
+	n := 100000
+	scores := func() *Scores {
+		s := New(WithExpiry(time.Hour))
+		for i := 0; i < n; i++ {
+			s.Add(Score{User: i, Value: i})
+		}
+		return s
+	}
+	runParallel(b, scores, func(b *testing.B, s benchmarkScores) {
+		b.RunParallel(func(pb *testing.PB) {
+			random := rand.New(rand.NewSource(time.Now().UnixNano()))
+			for i := 0; pb.Next(); i++ {
+				if i%51 == 0 {
+					s.Update(Score{User: random.Intn(n), Value: 1})
+					continue
+				}
+				query(s, random, n)
+			}
+		})
+	})
+}
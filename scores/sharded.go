@@ -0,0 +1,602 @@
+package scores
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync/atomic"
+)
+
+// Sharded keeps the scores in several independent shards, partitioning the users by a hash of their id,
+// so mutations of users in different shards run in parallel.
+//
+// The shards share the sequence numbers of the achieved scores, so equal scores are ranked across shards
+// exactly as in a single Scores. Queries lock all shards for reading, and merge their answers:
+// the top scores are merged from the top of every shard, and the rank of a score is the sum of the numbers
+// of scores ranked above it in every shard.
+// Dense ranks count the distinct better scores one by one, holding every shard, so they cost more as ranks grow,
+// and boards with many scores should not use them.
+//
+// Batches are not supported, since their mutations can go to different shards.
+//
+// Thread safe.
+type Sharded struct {
+	shards []*Scores
+	seq    uint64 // last sequence number of all shards
+}
+
+// NewSharded returns scores kept in n shards, each of them with the given options.
+func NewSharded(n int, options ...Option) *Sharded {
+	s := &Sharded{}
+	for i := 0; i < n; i++ {
+		s.shards = append(s.shards, New(append(options, withSequence(&s.seq))...))
+	}
+	return s
+}
+
+// OpenSharded returns the sharded scores persisted at path, creating them if they do not exist.
+//
+// Every shard is opened as by Open, the first one at path and the others at path.shardN,
+// so the number of shards must be the same every time the scores are opened.
+func OpenSharded(path string, n int, options ...Option) (*Sharded, error) {
+	s := &Sharded{}
+	for i := 0; i < n; i++ {
+		shardPath := path
+		if i > 0 {
+			shardPath = path + ".shard" + strconv.Itoa(i)
+		}
+		shard, err := Open(shardPath, append(options, withSequence(&s.seq))...)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		if shard.seq > s.seq {
+			s.seq = shard.seq
+		}
+		s.shards = append(s.shards, shard)
+	}
+	return s, nil
+}
+
+// withSequence makes the scores take the sequence numbers of the achieved scores from seq, shared with other scores.
+func withSequence(seq *uint64) Option {
+	return func(s *Scores) {
+		s.sequence = seq
+	}
+}
+
+// Add adds a new score for the user, as by Scores.Add.
+func (s *Sharded) Add(score Score) error {
+	return s.shard(score.User).Add(score)
+}
+
+// Update updates the score of an existing user, as by Scores.Update.
+func (s *Sharded) Update(score Score) (Score, error) {
+	return s.shard(score.User).Update(score)
+}
+
+// Remove removes the user and its score, as by Scores.Remove.
+func (s *Sharded) Remove(user int) error {
+	return s.shard(user).Remove(user)
+}
+
+// Apply applies the mutation, as by Scores.Apply.
+//
+// Idempotency keys are remembered by the shard of the user, so a key reused for a user of another shard is not detected.
+func (s *Sharded) Apply(m Mutation) (VersionedScore, error) {
+	return s.shard(m.User).Apply(m)
+}
+
+// ApplyBatch returns an error, since the mutations of a batch cannot be applied together across shards.
+func (s *Sharded) ApplyBatch(mutations []Mutation) ([]VersionedScore, error) {
+	return nil, errors.New("sharded scores do not support batches")
+}
+
+// SubmitIdempotent submits a score achieved by the user, as by Scores.SubmitIdempotent.
+//
+// The ranks are read before and after the submission, which are not atomic with it,
+// so they can include concurrent changes of other shards.
+func (s *Sharded) SubmitIdempotent(key string, user int, value int, policy SubmitPolicy, reason string) (Submission, error) {
+	previous, _, err := s.RankOf(user)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return Submission{}, err
+	}
+	sub, err := s.shard(user).SubmitIdempotent(key, user, value, policy, reason)
+	if err != nil {
+		return sub, err
+	}
+	sub.PreviousRank = previous
+	sub.Rank, _, err = s.RankOf(user)
+	if errors.Is(err, ErrUserNotFound) {
+		// the score expired in the meantime
+		err = nil
+	}
+	return sub, err
+}
+
+// History returns the changes of the score of the user, as by Scores.History.
+func (s *Sharded) History(user int, before int, limit int) ([]HistoryEntry, error) {
+	return s.shard(user).History(user, before, limit)
+}
+
+// Erase removes the user, if it has a score, together with its history, as by Scores.Erase.
+func (s *Sharded) Erase(user int) error {
+	return s.shard(user).Erase(user)
+}
+
+// Load loads the scores returned by next, sorted from best to worst, into empty scores, as by Scores.Load.
+//
+// The shards are locked only after all scores are read and checked, and if loading fails they stay empty.
+func (s *Sharded) Load(next func() (Score, error)) error {
+	s.rlock()
+	for _, shard := range s.shards {
+		if err := shard.loadable(); err != nil {
+			s.runlock()
+			return err
+		}
+	}
+	s.runlock()
+	nodes, err := s.shards[0].readSorted(next)
+	if err != nil {
+		return err
+	}
+	for _, shard := range s.shards {
+		shard.checkpointMu.Lock()
+		defer shard.checkpointMu.Unlock()
+		shard.mu.Lock()
+		defer shard.unlock()
+		if err := shard.loadable(); err != nil {
+			return err
+		}
+	}
+	shards := make([][]*Node, len(s.shards))
+	seq := atomic.AddUint64(&s.seq, uint64(len(nodes))) - uint64(len(nodes))
+	for _, node := range nodes {
+		node.seq += seq
+		j := s.index(node.user)
+		shards[j] = append(shards[j], node)
+	}
+	// every shard is built and its snapshot staged before any snapshot is committed,
+	// so a shard which cannot be persisted leaves all shards empty
+	for i, shard := range s.shards {
+		shard.install(shards[i])
+		if shard.log == nil || len(shards[i]) == 0 {
+			continue
+		}
+		if err := shard.stageSnapshot(shard.snapshot()); err != nil {
+			for _, loaded := range s.shards[:i+1] {
+				loaded.uninstall()
+				if loaded.log != nil {
+					loaded.discardSnapshot()
+				}
+			}
+			return err
+		}
+	}
+	for i, shard := range s.shards {
+		if shard.log == nil || len(shards[i]) == 0 {
+			continue
+		}
+		if err := shard.commitLoad(); err != nil {
+			// the shards committed before are rolled back too, so either all shards are loaded or none is
+			for _, loaded := range s.shards {
+				if rollbackErr := loaded.rollbackLoad(); rollbackErr != nil {
+					err = fmt.Errorf("%w, and rolling back the load failed: %v", err, rollbackErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup returns the score of the user, with its rank and its version, as by Scores.Lookup.
+func (s *Sharded) Lookup(user int) (RankedScore, uint64, error) {
+	s.rlock()
+	defer s.runlock()
+	node, ok := s.shard(user).users[user]
+	if !ok {
+		return RankedScore{}, 0, fmt.Errorf("%w: %d", ErrUserNotFound, user)
+	}
+	return RankedScore{Score: Score{User: node.user, Value: node.score}, Rank: s.rankOf(node, s.RankMode())}, node.seq, nil
+}
+
+// RankOf returns the rank of the user, together with its score, as by Scores.RankOf.
+func (s *Sharded) RankOf(user int) (int, Score, error) {
+	score, _, err := s.Lookup(user)
+	return score.Rank, score.Score, err
+}
+
+// PositionOf returns the ordinal rank of the user, as by Scores.PositionOf.
+func (s *Sharded) PositionOf(user int) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	node, ok := s.shard(user).users[user]
+	if !ok {
+		return 0, fmt.Errorf("%w: %d", ErrUserNotFound, user)
+	}
+	return s.rankOf(node, OrdinalRank), nil
+}
+
+// Top returns top scores from best to worst, as by Scores.Top.
+func (s *Sharded) Top(top int) []Score {
+	s.rlock()
+	defer s.runlock()
+	return scoresOf(s.merge(s.tops(), top, false))
+}
+
+// TopRanked returns top scores from best to worst, annotated with their rank according to mode, as by Scores.TopRanked.
+func (s *Sharded) TopRanked(top int, mode RankMode) []RankedScore {
+	s.rlock()
+	defer s.runlock()
+	return s.rank(scoresOf(s.merge(s.tops(), top, false)), 1, mode)
+}
+
+// Range returns scores ranked between position-size and position+size, as by Scores.Range.
+func (s *Sharded) Range(position int, count int) []Score {
+	s.rlock()
+	defer s.runlock()
+	scores, _ := s.rangeOf(position, count)
+	return scores
+}
+
+// RangeRanked returns scores ranked between position-size and position+size, annotated with their rank
+// according to mode, as by Scores.RangeRanked.
+func (s *Sharded) RangeRanked(position int, count int, mode RankMode) []RankedScore {
+	s.rlock()
+	defer s.runlock()
+	scores, start := s.rangeOf(position, count)
+	return s.rank(scores, start, mode)
+}
+
+// AroundUser returns the scores ranked around the user, as by Scores.AroundUser.
+func (s *Sharded) AroundUser(user int, count int) ([]RankedScore, error) {
+	s.rlock()
+	defer s.runlock()
+	node, ok := s.shard(user).users[user]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUserNotFound, user)
+	}
+	scores, start := s.rangeOf(s.rankOf(node, OrdinalRank), count)
+	return s.rank(scores, start, s.RankMode()), nil
+}
+
+// Len returns the number of users that have a score.
+func (s *Sharded) Len() int {
+	s.rlock()
+	defer s.runlock()
+	return s.len()
+}
+
+// Walk calls fn with the scores from best to worst, starting with the one ranked from, as by Scores.Walk.
+func (s *Sharded) Walk(from int, fn func(RankedScore) bool) {
+	if from < 1 {
+		from = 1
+	}
+	var last *Node // copy of the last score of the previous chunk
+	for {
+		chunk, next := s.walkChunk(from, last)
+		for _, score := range chunk {
+			if !fn(score) {
+				return
+			}
+		}
+		if next == nil {
+			return
+		}
+		last = next
+	}
+}
+
+// walkChunk returns the next chunk of Walk, as by Scores.walkChunk.
+func (s *Sharded) walkChunk(from int, last *Node) ([]RankedScore, *Node) {
+	s.rlock()
+	defer s.runlock()
+	next := make([]*Node, len(s.shards))
+	if last == nil {
+		first := s.nodeAt(from)
+		if first == nil {
+			return nil, nil
+		}
+		for i, shard := range s.shards {
+			next[i] = shard.working().nextBelow(first)
+			if shard.users[first.user] == first {
+				next[i] = first
+			}
+		}
+	} else {
+		for i, shard := range s.shards {
+			next[i] = shard.working().nextBelow(last)
+		}
+	}
+	nodes := s.merge(next, walkChunk, false)
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	first := nodes[0]
+	last = nodes[len(nodes)-1]
+	last = &Node{score: last.score, user: last.user, seq: last.seq}
+	if len(nodes) < walkChunk {
+		last = nil
+	}
+	return s.rank(scoresOf(nodes), s.rankOf(first, OrdinalRank), s.RankMode()), last
+}
+
+// Page returns at most limit scores next to the cursor, in the direction of the cursor, as by Scores.Page.
+func (s *Sharded) Page(cursor Cursor, limit int) Page {
+	s.rlock()
+	defer s.runlock()
+	if limit <= 0 {
+		return Page{}
+	}
+	key := &Node{score: cursor.score, seq: cursor.seq, user: cursor.user}
+	next := make([]*Node, len(s.shards))
+	for i, shard := range s.shards {
+		switch {
+		case cursor.backward:
+			next[i] = shard.working().nextAbove(key)
+		case cursor.set:
+			next[i] = shard.working().nextBelow(key)
+		default:
+			next[i] = shard.root.nodeAt(1)
+		}
+	}
+	nodes := s.merge(next, limit, cursor.backward)
+	if len(nodes) == 0 {
+		return Page{}
+	}
+	first, last := nodes[0], nodes[len(nodes)-1]
+	start := s.rankOf(first, OrdinalRank)
+	page := Page{Scores: s.rank(scoresOf(nodes), start, s.RankMode())}
+	if start > 1 {
+		page.Prev = Cursor{set: true, backward: true, score: first.score, seq: first.seq, user: first.user}
+	}
+	if start+len(nodes)-1 < s.len() {
+		page.Next = Cursor{set: true, score: last.score, seq: last.seq, user: last.user}
+	}
+	return page
+}
+
+// TopTag returns a tag of the top scores which changes whenever one of them changes, as by Scores.TopTag.
+//
+// It changes whenever the top scores of any shard change.
+func (s *Sharded) TopTag(top int) (string, bool) {
+	if top > TopCacheSize {
+		return "", false
+	}
+	h := fnv.New64a()
+	for _, shard := range s.shards {
+		tag, _ := shard.TopTag(top)
+		h.Write([]byte(tag))
+	}
+	return strconv.FormatUint(h.Sum64(), 36), true
+}
+
+// RankMode returns the rank mode used by RankOf and AroundUser, as by Scores.RankMode.
+func (s *Sharded) RankMode() RankMode {
+	return s.shards[0].RankMode()
+}
+
+// Sweep removes the expired scores of all shards, returning their number.
+func (s *Sharded) Sweep() int {
+	var n int
+	for _, shard := range s.shards {
+		n += shard.Sweep()
+	}
+	return n
+}
+
+// Checkpoint checkpoints every shard, as by Scores.Checkpoint.
+func (s *Sharded) Checkpoint() error {
+	for _, shard := range s.shards {
+		if err := shard.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes every shard.
+func (s *Sharded) Close() error {
+	var err error
+	for _, shard := range s.shards {
+		if closeErr := shard.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// shard returns the shard of the user.
+func (s *Sharded) shard(user int) *Scores {
+	return s.shards[s.index(user)]
+}
+
+// index returns the index of the shard of the user.
+func (s *Sharded) index(user int) int {
+	// a multiplicative hash, so users with consecutive ids go to different shards
+	return int((uint64(user) * 0x9e3779b97f4a7c15 >> 32) % uint64(len(s.shards)))
+}
+
+// rlock locks all shards for reading, in order, so queries see all of them at the same time.
+func (s *Sharded) rlock() {
+	for _, shard := range s.shards {
+		shard.rlock()
+	}
+}
+
+// runlock unlocks all shards locked by rlock.
+func (s *Sharded) runlock() {
+	for _, shard := range s.shards {
+		shard.mu.RUnlock()
+	}
+}
+
+// The methods below must be called with all shards locked, at least for reading.
+
+// below returns whether node a is ranked below node b, as by Scores.below.
+func (s *Sharded) below(a, b *Node) bool {
+	return s.shards[0].below(a, b)
+}
+
+// len returns the number of users in all shards.
+func (s *Sharded) len() int {
+	var n int
+	for _, shard := range s.shards {
+		n += len(shard.users)
+	}
+	return n
+}
+
+// tops returns the best node of every shard.
+func (s *Sharded) tops() []*Node {
+	next := make([]*Node, len(s.shards))
+	for i, shard := range s.shards {
+		next[i] = shard.root.nodeAt(1)
+	}
+	return next
+}
+
+// merge returns at most limit nodes from best to worst, starting with the best of the nodes in next,
+// which has a node of every shard, or nil, and continuing with the nodes ranked below them in their shards.
+//
+// If backward, it starts with the worst of the nodes and continues with the nodes ranked above them instead,
+// but it still returns the nodes from best to worst.
+func (s *Sharded) merge(next []*Node, limit int, backward bool) []*Node {
+	var nodes []*Node
+	for len(nodes) < limit {
+		pick := -1
+		for i, n := range next {
+			if n == nil {
+				continue
+			}
+			if pick < 0 || (!backward && s.below(next[pick], n)) || (backward && s.below(n, next[pick])) {
+				pick = i
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		nodes = append(nodes, next[pick])
+		if backward {
+			next[pick] = s.shards[pick].working().nextAbove(next[pick])
+		} else {
+			next[pick] = s.shards[pick].working().nextBelow(next[pick])
+		}
+	}
+	if backward {
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+	}
+	return nodes
+}
+
+// rangeOf returns the scores ranked between position-size and position+size, with the position of the first of them.
+func (s *Sharded) rangeOf(position int, count int) ([]Score, int) {
+	start := position - count
+	if start < 1 {
+		start = 1
+	}
+	first := s.nodeAt(start)
+	if first == nil {
+		return nil, start
+	}
+	next := make([]*Node, len(s.shards))
+	for i, shard := range s.shards {
+		next[i] = shard.working().nextBelow(first)
+		if shard.users[first.user] == first {
+			next[i] = first
+		}
+	}
+	return scoresOf(s.merge(next, position+count-start+1, false)), start
+}
+
+// nodeAt returns the node ranked rank among all shards, starting from 1, or nil if there is none.
+//
+// The ranks of the nodes of a shard among all shards grow with their ranks in the shard,
+// so we binary search every shard for a node with the given rank.
+func (s *Sharded) nodeAt(rank int) *Node {
+	for _, shard := range s.shards {
+		low, high := 1, len(shard.users)
+		if rank < high {
+			high = rank
+		}
+		for low <= high {
+			mid := (low + high) / 2
+			n := shard.root.nodeAt(mid)
+			switch r := s.rankOf(n, OrdinalRank); {
+			case r == rank:
+				return n
+			case r < rank:
+				low = mid + 1
+			default:
+				high = mid - 1
+			}
+		}
+	}
+	return nil
+}
+
+// rankOf returns the rank of the node among all shards, according to mode.
+func (s *Sharded) rankOf(n *Node, mode RankMode) int {
+	switch mode {
+	case CompetitionRank:
+		return s.countBetter(n.score) + 1
+	case DenseRank:
+		return s.countDistinctBetter(n.score) + 1
+	}
+	rank := 1
+	for _, shard := range s.shards {
+		rank += shard.working().countAbove(n)
+	}
+	return rank
+}
+
+// rank annotates consecutive scores with their rank among all shards, according to mode.
+func (s *Sharded) rank(scores []Score, start int, mode RankMode) []RankedScore {
+	return rank(scores, start, mode, s.countBetter, s.countDistinctBetter)
+}
+
+// countBetter returns the number of scores of all shards strictly better than value.
+func (s *Sharded) countBetter(value int) int {
+	var count int
+	for _, shard := range s.shards {
+		count += shard.working().countBetter(value)
+	}
+	return count
+}
+
+// countDistinctBetter returns the number of distinct scores of all shards strictly better than value.
+//
+// Equal scores can be in different shards, so the distinct scores cannot be counted by every shard.
+// Instead, we go from value to the best score, through the next better score of all shards.
+func (s *Sharded) countDistinctBetter(value int) int {
+	var count int
+	for {
+		next, ok := 0, false
+		for _, shard := range s.shards {
+			if v, found := shard.working().nextBetter(value); found && (!ok || shard.better(next, v)) {
+				next, ok = v, true
+			}
+		}
+		if !ok {
+			return count
+		}
+		count++
+		value = next
+	}
+}
+
+// scoresOf returns the scores of the nodes.
+func scoresOf(nodes []*Node) []Score {
+	if len(nodes) == 0 {
+		return nil
+	}
+	scores := make([]Score, len(nodes))
+	for i, n := range nodes {
+		scores[i] = Score{User: n.user, Value: n.score}
+	}
+	return scores
+}
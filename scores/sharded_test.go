@@ -0,0 +1,228 @@
+package scores
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestSharded tests that sharded scores answer every query exactly as a single tree with the same scores.
+func TestSharded(t *testing.T) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for _, tieBreak := range []TieBreak{LastAchieverWins, FirstAchieverWins, LowerUserWins, SharedRank} {
+		for _, mode := range []RankMode{OrdinalRank, CompetitionRank, DenseRank} {
+			single := New(WithTieBreak(tieBreak), WithRankMode(mode))
+			sharded := NewSharded(4, WithTieBreak(tieBreak), WithRankMode(mode))
+			for i := 0; i < 2000; i++ {
+				user, value := random.Intn(300), random.Intn(50)
+				switch random.Intn(4) {
+				case 0, 1:
+					single.Add(Score{User: user, Value: value})
+					sharded.Add(Score{User: user, Value: value})
+				case 2:
+					single.Update(Score{User: user, Value: value%10 - 5})
+					sharded.Update(Score{User: user, Value: value%10 - 5})
+				case 3:
+					single.Remove(user)
+					sharded.Remove(user)
+				}
+			}
+			assertSameScores(t, single, sharded)
+		}
+	}
+}
+
+// assertSameScores asserts that the sharded scores answer the queries as the single tree.
+func assertSameScores(t *testing.T, single *Scores, sharded *Sharded) {
+	t.Helper()
+	n := single.Len()
+	if sharded.Len() != n {
+		t.Fatalf("got %d users, expected: %d", sharded.Len(), n)
+	}
+	for _, top := range []int{0, 1, 10, n, n + 1} {
+		if calculated, expected := sharded.TopRanked(top, single.RankMode()), single.TopRanked(top, single.RankMode()); !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("got top %d: \n%v\n expected: \n%v\n", top, calculated, expected)
+		}
+	}
+	for _, position := range []int{1, 2, n / 3, n, n + 1} {
+		if calculated, expected := sharded.RangeRanked(position, 5, OrdinalRank), single.RangeRanked(position, 5, OrdinalRank); !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("got range at %d: \n%v\n expected: \n%v\n", position, calculated, expected)
+		}
+	}
+	for _, score := range single.Top(n) {
+		rank, _, err := sharded.RankOf(score.User)
+		if expected, _, _ := single.RankOf(score.User); err != nil || rank != expected {
+			t.Fatalf("got rank %d, %v of user %d, expected: %d", rank, err, score.User, expected)
+		}
+		calculated, err := sharded.AroundUser(score.User, 3)
+		if expected, _ := single.AroundUser(score.User, 3); err != nil || !reflect.DeepEqual(calculated, expected) {
+			t.Fatalf("got scores around user %d: \n%v\n expected: \n%v\n", score.User, calculated, expected)
+		}
+	}
+	var walked []RankedScore
+	sharded.Walk(2, func(score RankedScore) bool {
+		walked = append(walked, score)
+		return true
+	})
+	if expected := single.RangeRanked(n, n, single.RankMode()); n > 1 && !reflect.DeepEqual(walked, expected[1:]) {
+		t.Fatalf("got walk: \n%v\n expected: \n%v\n", walked, expected[1:])
+	}
+	for page, expected := sharded.Page(Cursor{}, 7), single.Page(Cursor{}, 7); ; page, expected = sharded.Page(page.Next, 7), single.Page(expected.Next, 7) {
+		if !reflect.DeepEqual(page.Scores, expected.Scores) || (page.Next == Cursor{}) != (expected.Next == Cursor{}) {
+			t.Fatalf("got page: \n%v\n expected: \n%v\n", page, expected)
+		}
+		if back := sharded.Page(page.Prev, 7); page.Prev != (Cursor{}) && !reflect.DeepEqual(back.Scores, single.Page(expected.Prev, 7).Scores) {
+			t.Fatalf("got previous page: \n%v\n expected: \n%v\n", back, single.Page(expected.Prev, 7))
+		}
+		if page.Next == (Cursor{}) {
+			break
+		}
+	}
+}
+
+// TestShardedPersisted tests that persisted sharded scores rank equal scores of different shards
+// in the order they were achieved, also after they are opened again.
+func TestShardedPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := OpenSharded(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := New()
+	for i := 0; i < 100; i++ {
+		s.Add(Score{User: i, Value: i % 5})
+		single.Add(Score{User: i, Value: i % 5})
+	}
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i += 3 {
+		s.Update(Score{User: i, Value: 1})
+		single.Update(Score{User: i, Value: 1})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = OpenSharded(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := 100; i < 110; i++ {
+		s.Add(Score{User: i, Value: i % 5})
+		single.Add(Score{User: i, Value: i % 5})
+	}
+	assertSameScores(t, single, s)
+	if _, err := s.ApplyBatch([]Mutation{{Kind: MutationAdd, User: 200, Value: 1}}); err == nil {
+		t.Fatalf("expected error for a batch")
+	}
+}
+
+// TestShardedLoad tests that loading sharded scores ranks them as loading a single tree.
+func TestShardedLoad(t *testing.T) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	added := New()
+	for i := 0; i < 500; i++ {
+		added.Add(Score{User: i, Value: random.Intn(50)})
+	}
+	single, sharded := New(), NewSharded(4)
+	if err := single.Load(sliceScores(added.Top(500))); err != nil {
+		t.Fatal(err)
+	}
+	if err := sharded.Load(sliceScores(added.Top(500))); err != nil {
+		t.Fatal(err)
+	}
+	single.Add(Score{User: 1000, Value: 25})
+	sharded.Add(Score{User: 1000, Value: 25})
+	assertSameScores(t, single, sharded)
+	if err := sharded.Load(sliceScores(added.Top(500))); err == nil {
+		t.Fatalf("expected error for scores which are not empty")
+	}
+}
+
+// TestShardedLoadFailure tests that a shard which cannot be persisted leaves all shards empty,
+// also after they are opened again.
+func TestShardedLoadFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := OpenSharded(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { s.Close() }()
+	added := New()
+	for i := 0; i < 100; i++ {
+		added.Add(Score{User: i, Value: i % 7})
+	}
+	// the snapshot of the last shard cannot be staged
+	staged := path + ".shard2" + SnapshotExt + ".tmp"
+	if err := os.Mkdir(staged, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(sliceScores(added.Top(100))); err == nil {
+		t.Fatalf("expected error for a shard which cannot be persisted")
+	}
+	if n := s.Len(); n != 0 {
+		t.Fatalf("got %d users after failing to load, expected none", n)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = OpenSharded(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Len(); n != 0 {
+		t.Fatalf("got %d users after opening the scores again, expected none", n)
+	}
+	// the staged snapshots are discarded, so loading can be retried
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Fatalf("got staged snapshot after failing to load: %v", err)
+	}
+	if err := s.Load(sliceScores(added.Top(100))); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = OpenSharded(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	if calculated, expected := s.Top(100), added.Top(100); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores: %v, expected: %v", calculated, expected)
+	}
+}
+
+// TestShardedLoadCommitFailure tests that a shard whose loaded scores cannot be committed
+// rolls back the shards committed before it, also after they are opened again.
+func TestShardedLoadCommitFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := OpenSharded(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { s.Close() }()
+	added := New()
+	for i := 0; i < 100; i++ {
+		added.Add(Score{User: i, Value: i % 7})
+	}
+	// the log of the last shard cannot be compacted, after the other shards are committed
+	if err := os.Mkdir(path+".shard2"+LogExt+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(sliceScores(added.Top(100))); err == nil {
+		t.Fatalf("expected error for a shard which cannot be committed")
+	}
+	if n := s.Len(); n != 0 {
+		t.Fatalf("got %d users after failing to load, expected none", n)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = OpenSharded(path, 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Len(); n != 0 {
+		t.Fatalf("got %d users after opening the scores again, expected none", n)
+	}
+}
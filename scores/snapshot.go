@@ -0,0 +1,429 @@
+package scores
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// A snapshot starts with snapshotMagic and the version of its format, followed by
+// the sequence number of the last log record included in the snapshot, the sequence number
+// of the last achieved score, the number of scores, and the scores from best to worst,
+// each as its user, value, the sequence number of its achievement and the time of its achievement
+// as unix nanoseconds, which is 0 if scores do not expire.
+// The scores are followed by the number of users with history, and the history of each of them,
+// as its user, the number of changes, the number of the first change, and every change as its delta, total, time,
+// reason, and 1 if the user was removed by it or 0 otherwise.
+// They are followed by the number of remembered results of mutations with idempotency keys,
+// and the results from the oldest to the newest, each as its key, user, value and version.
+// All numbers are varints, strings are prefixed by their length, and the snapshot ends with
+// the crc32 checksum of all previous bytes.
+const (
+	snapshotMagic   = "GSSN"
+	snapshotVersion = 1
+)
+
+// snapshot is a copy of the scores, which can be written without holding the lock of the scores.
+type snapshot struct {
+	lsn     uint64
+	seq     uint64
+	entries []snapshotEntry
+	history map[int][]HistoryEntry
+	dedup   []dedupEntry
+}
+
+// snapshotEntry is a score in a snapshot.
+type snapshotEntry struct {
+	Score
+	seq uint64
+	at  int64
+}
+
+// Snapshot writes all scores to w, in a compact binary format that can be read by Restore.
+//
+// The scores are copied while holding the lock, but they are written after releasing it.
+func (s *Scores) Snapshot(w io.Writer) error {
+	s.mu.RLock()
+	snap := s.snapshot()
+	s.mu.RUnlock()
+	return snap.write(w)
+}
+
+// Restore reads the scores written by Snapshot.
+//
+// The options should be the same as the ones of the snapshotted scores.
+func Restore(r io.Reader, options ...Option) (*Scores, error) {
+	snap, err := readSnapshot(r)
+	if err != nil {
+		return nil, err
+	}
+	s := New(options...)
+	s.restore(snap)
+	s.publish()
+	return s, nil
+}
+
+// Checkpoint writes a snapshot of the scores next to their log,
+// and then removes from the log the records included in the snapshot.
+//
+// The snapshot is written to a temporary file which is then renamed, so a crash leaves either the old
+// or the new snapshot in place. Only scores returned by Open can be checkpointed.
+func (s *Scores) Checkpoint() error {
+	s.checkpointMu.Lock()
+	defer s.checkpointMu.Unlock()
+	s.mu.Lock()
+	if s.log == nil {
+		s.unlock()
+		return errors.New("scores are not persisted")
+	}
+	offset := s.log.size
+	if offset == int64(logHeaderSize) {
+		// nothing changed since the last snapshot
+		s.unlock()
+		return nil
+	}
+	snap := s.snapshot()
+	s.unlock()
+
+	if err := s.writeSnapshot(snap); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	return s.log.compact(offset)
+}
+
+// writeSnapshot writes the snapshot next to the log of the scores, replacing the previous one.
+func (s *Scores) writeSnapshot(snap snapshot) error {
+	if err := s.stageSnapshot(snap); err != nil {
+		return err
+	}
+	return s.commitSnapshot()
+}
+
+// stageSnapshot writes the snapshot to a temporary file next to the log of the scores,
+// which replaces the previous snapshot only when it is committed.
+func (s *Scores) stageSnapshot(snap snapshot) error {
+	f, err := os.Create(s.path + SnapshotExt + ".tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := snap.write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// commitSnapshot replaces the previous snapshot with the staged one.
+func (s *Scores) commitSnapshot() error {
+	if err := os.Rename(s.path+SnapshotExt+".tmp", s.path+SnapshotExt); err != nil {
+		return err
+	}
+	return syncDir(s.dir())
+}
+
+// discardSnapshot removes the staged snapshot, keeping the previous one.
+func (s *Scores) discardSnapshot() {
+	os.Remove(s.path + SnapshotExt + ".tmp")
+}
+
+// snapshot copies the scores from best to worst.
+func (s *Scores) snapshot() snapshot {
+	snap := snapshot{seq: s.seq, entries: make([]snapshotEntry, 0, len(s.users)), dedup: s.dedup.list()}
+	if s.history != nil {
+		// histories are only appended to, so copying their slices is enough
+		snap.history = make(map[int][]HistoryEntry, len(s.history))
+		for user, entries := range s.history {
+			snap.history[user] = entries
+		}
+	}
+	if s.log != nil {
+		snap.lsn = s.log.lsn
+	}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n == nil {
+			return
+		}
+		walk(n.right)
+		snap.entries = append(snap.entries, snapshotEntry{Score: Score{User: n.user, Value: n.score}, seq: n.seq, at: n.at})
+		walk(n.left)
+	}
+	walk(s.root)
+	return snap
+}
+
+// restore replaces the scores with the ones from the snapshot.
+func (s *Scores) restore(snap snapshot) {
+	s.root, s.userIndex = nil, nil
+	s.top.invalidate()
+	s.changed = true
+	s.users = make(map[int]*Node, len(snap.entries))
+	s.expiry = nil
+	s.seq = snap.seq
+	if s.history != nil && snap.history != nil {
+		s.history = snap.history
+	}
+	if s.dedup != nil {
+		s.dedup = &dedupTable{size: s.dedup.size, entries: make(map[string]dedupEntry)}
+		for _, entry := range snap.dedup {
+			s.dedup.add(entry.key, entry.score)
+		}
+	}
+	for _, entry := range snap.entries {
+		node := &Node{score: entry.Value, user: entry.User, seq: entry.seq, at: entry.at}
+		s.insert(node)
+		s.users[entry.User] = node
+		s.indexUser(node)
+		s.track(node)
+	}
+}
+
+// write writes the snapshot to w.
+func (snap snapshot) write(w io.Writer) error {
+	crc := crc32.New(crcTable)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	buf := append([]byte(snapshotMagic), snapshotVersion)
+	buf = appendUvarint(buf, snap.lsn)
+	buf = appendUvarint(buf, snap.seq)
+	buf = appendUvarint(buf, uint64(len(snap.entries)))
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	for _, entry := range snap.entries {
+		buf = appendVarint(buf[:0], int64(entry.User))
+		buf = appendVarint(buf, int64(entry.Value))
+		buf = appendUvarint(buf, entry.seq)
+		buf = appendVarint(buf, entry.at)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	buf = appendUvarint(buf[:0], uint64(len(snap.history)))
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	for user, entries := range snap.history {
+		buf = appendVarint(buf[:0], int64(user))
+		buf = appendUvarint(buf, uint64(len(entries)))
+		buf = appendUvarint(buf, uint64(entries[0].Seq))
+		for _, entry := range entries {
+			buf = appendVarint(buf, int64(entry.Delta))
+			buf = appendVarint(buf, int64(entry.Total))
+			buf = appendVarint(buf, entry.Time.UnixNano())
+			buf = appendString(buf, entry.Reason)
+			var removed byte
+			if entry.Removed {
+				removed = 1
+			}
+			buf = append(buf, removed)
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	buf = appendUvarint(buf[:0], uint64(len(snap.dedup)))
+	for _, entry := range snap.dedup {
+		buf = appendString(buf, entry.key)
+		buf = appendVarint(buf, int64(entry.score.User))
+		buf = appendVarint(buf, int64(entry.score.Value))
+		buf = appendUvarint(buf, entry.score.Version)
+	}
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc.Sum32())
+	_, err := w.Write(sum[:])
+	return err
+}
+
+// readSnapshot reads a snapshot written by write.
+func readSnapshot(r io.Reader) (snapshot, error) {
+	var snap snapshot
+	crc := crc32.New(crcTable)
+	br := &hashReader{r: bufio.NewReader(r), h: crc}
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return snap, fmt.Errorf("reading snapshot header: %w", err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return snap, errors.New("not a snapshot")
+	}
+	if version := header[len(snapshotMagic)]; version != snapshotVersion {
+		return snap, fmt.Errorf("unknown snapshot version: %d", version)
+	}
+	var err error
+	if snap.lsn, err = binary.ReadUvarint(br); err != nil {
+		return snap, fmt.Errorf("reading snapshot: %w", err)
+	}
+	if snap.seq, err = binary.ReadUvarint(br); err != nil {
+		return snap, fmt.Errorf("reading snapshot: %w", err)
+	}
+	// the counts are read before the checksum is checked, so nothing is allocated for them in advance,
+	// and a corrupted count fails when the snapshot ends instead of allocating memory for it
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return snap, fmt.Errorf("reading snapshot: %w", err)
+	}
+	for i := uint64(0); i < count; i++ {
+		user, err := binary.ReadVarint(br)
+		if err != nil {
+			return snap, fmt.Errorf("reading snapshot: %w", err)
+		}
+		value, err := binary.ReadVarint(br)
+		if err != nil {
+			return snap, fmt.Errorf("reading snapshot: %w", err)
+		}
+		entry := snapshotEntry{Score: Score{User: int(user), Value: int(value)}}
+		if entry.seq, err = binary.ReadUvarint(br); err != nil {
+			return snap, fmt.Errorf("reading snapshot: %w", err)
+		}
+		if entry.at, err = binary.ReadVarint(br); err != nil {
+			return snap, fmt.Errorf("reading snapshot: %w", err)
+		}
+		snap.entries = append(snap.entries, entry)
+	}
+	if snap.history, err = readHistory(br); err != nil {
+		return snap, fmt.Errorf("reading snapshot history: %w", err)
+	}
+	if snap.dedup, err = readDedup(br); err != nil {
+		return snap, fmt.Errorf("reading snapshot results: %w", err)
+	}
+	expected := crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(br.r, sum[:]); err != nil {
+		return snap, fmt.Errorf("reading snapshot checksum: %w", err)
+	}
+	if binary.LittleEndian.Uint32(sum[:]) != expected {
+		return snap, errors.New("corrupted snapshot")
+	}
+	return snap, nil
+}
+
+// readHistory reads the history of the users from a snapshot.
+func readHistory(br *hashReader) (map[int][]HistoryEntry, error) {
+	users, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	history := make(map[int][]HistoryEntry)
+	for i := uint64(0); i < users; i++ {
+		user, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, err
+		}
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		first, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		var entries []HistoryEntry
+		for j := uint64(0); j < count; j++ {
+			entry := HistoryEntry{Seq: int(first + j)}
+			var v [3]int64
+			for k := range v {
+				if v[k], err = binary.ReadVarint(br); err != nil {
+					return nil, err
+				}
+			}
+			entry.Delta, entry.Total, entry.Time = int(v[0]), int(v[1]), time.Unix(0, v[2])
+			if entry.Reason, err = readString(br, MaxReasonSize); err != nil {
+				return nil, err
+			}
+			removed, err := br.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			entry.Removed = removed == 1
+			entries = append(entries, entry)
+		}
+		history[int(user)] = entries
+	}
+	return history, nil
+}
+
+// readDedup reads the results of mutations with idempotency keys from a snapshot.
+func readDedup(br *hashReader) ([]dedupEntry, error) {
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	var entries []dedupEntry
+	for i := uint64(0); i < count; i++ {
+		var entry dedupEntry
+		if entry.key, err = readString(br, MaxKeySize); err != nil {
+			return nil, err
+		}
+		var v [2]int64
+		for k := range v {
+			if v[k], err = binary.ReadVarint(br); err != nil {
+				return nil, err
+			}
+		}
+		entry.score.Score = Score{User: int(v[0]), Value: int(v[1])}
+		if entry.score.Version, err = binary.ReadUvarint(br); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readString reads a string prefixed by its length, which cannot be longer than limit.
+func readString(br *hashReader, limit int) (string, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return "", err
+	}
+	if size > uint64(limit) {
+		return "", errors.New("string too long")
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// hashReader hashes all bytes read through it.
+type hashReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+}
+
+func (r *hashReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	return n, err
+}
+
+func (r *hashReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.h.Write([]byte{b})
+	}
+	return b, err
+}
@@ -0,0 +1,121 @@
+package scores
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSnapshotRestore tests that restoring a snapshot gives the same scores, including the order of equal ones.
+func TestSnapshotRestore(t *testing.T) {
+	s := New()
+	_, sortedScores := generateScores(s)
+	var buf bytes.Buffer
+	if err := s.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := Restore(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBST(t, restored, sortedScores)
+	assertBalanced(t, restored)
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	if _, err := Restore(bytes.NewReader(data)); err == nil {
+		t.Fatalf("expected error for corrupted snapshot")
+	}
+}
+
+// TestSnapshotCorruptedCount tests that a corrupted count of a snapshot is an error, without allocating memory for it.
+func TestSnapshotCorruptedCount(t *testing.T) {
+	data := append([]byte(snapshotMagic), snapshotVersion)
+	data = appendUvarint(data, 0)     // lsn
+	data = appendUvarint(data, 0)     // seq
+	data = appendUvarint(data, 0)     // scores
+	data = appendUvarint(data, 1)     // users with history
+	data = appendVarint(data, 1)      // user
+	data = appendUvarint(data, 1<<50) // changes
+	data = appendUvarint(data, 1)     // first change
+	data = appendVarint(data, 1)      // delta
+	if _, err := Restore(bytes.NewReader(data)); err == nil {
+		t.Fatalf("expected error for corrupted snapshot")
+	}
+}
+
+// TestCheckpoint tests that the scores are restored from the snapshot and the compacted log.
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generateScores(s)
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path + LogExt); err != nil || info.Size() != int64(logHeaderSize) {
+		t.Fatalf("expected empty log after checkpoint: %v %v", info, err)
+	}
+	s.Update(Score{User: 1, Value: 3})
+	s.Remove(2)
+	s.Add(Score{User: 2, Value: 4})
+	expected := s.Top(20)
+	s.Close()
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if calculated := s.Top(20); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got restored scores: \n%v\n expected: \n%v\n", calculated, expected)
+	}
+	assertBalanced(t, s)
+}
+
+// TestCheckpointCrash tests that records already in the snapshot are not applied twice,
+// if we crash after writing the snapshot but before compacting the log.
+func TestCheckpointCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generateScores(s)
+	s.Update(Score{User: 1, Value: 3})
+	uncompacted, err := os.ReadFile(path + LogExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	expected := s.Top(20)
+	s.Close()
+	if err := os.WriteFile(path+LogExt, uncompacted, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calculated := s.Top(20); !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got restored scores: \n%v\n expected: \n%v\n", calculated, expected)
+	}
+	// new records must follow the ones in the snapshot, so they are not skipped either
+	newScore, err := s.Update(Score{User: 1, Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, score, _ := s.RankOf(1); score != newScore {
+		t.Fatalf("got score %v, expected: %v", score, newScore)
+	}
+}
@@ -0,0 +1,142 @@
+package scores
+
+import (
+	"fmt"
+)
+
+// SubmitPolicy decides how a submitted score changes the score of the user.
+type SubmitPolicy int
+
+const (
+	// KeepBest keeps the better of the submitted score and the current one.
+	KeepBest SubmitPolicy = iota
+	// KeepLatest replaces the current score with the submitted one.
+	KeepLatest
+	// Accumulate adds the submitted score to the current one.
+	Accumulate
+)
+
+var submitPolicyNames = map[SubmitPolicy]string{
+	KeepBest:   "best",
+	KeepLatest: "latest",
+	Accumulate: "accumulate",
+}
+
+func (p SubmitPolicy) String() string {
+	if name, ok := submitPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("SubmitPolicy(%d)", int(p))
+}
+
+// ParseSubmitPolicy returns the submit policy with the given name, as returned by String.
+//
+// The empty name is KeepBest.
+func ParseSubmitPolicy(name string) (SubmitPolicy, error) {
+	if name == "" {
+		return KeepBest, nil
+	}
+	for p, pName := range submitPolicyNames {
+		if pName == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown submit policy: %q", name)
+}
+
+// Submission is the result of submitting a score.
+type Submission struct {
+	Score               // score of the user after the submission
+	Rank         int    // rank of the user after the submission
+	PreviousRank int    // rank of the user before the submission, 0 if the user did not have a score
+	Created      bool   // whether the user did not have a score before
+	Version      uint64 // version of the score of the user after the submission
+}
+
+// RankChanged returns whether the submission changed the rank of the user.
+func (s Submission) RankChanged() bool {
+	return s.Rank != s.PreviousRank
+}
+
+// Submit submits a score achieved by the user, which is kept according to the policy.
+//
+// If the user does not have a score, the submitted one is added, whatever the policy.
+// Ranks are calculated according to the rank mode of the scores.
+func (s *Scores) Submit(user int, value int, policy SubmitPolicy) (Submission, error) {
+	return s.SubmitWithReason(user, value, policy, "")
+}
+
+// SubmitWithReason submits a score achieved by the user, as by Submit, recording the reason in its history.
+func (s *Scores) SubmitWithReason(user int, value int, policy SubmitPolicy, reason string) (Submission, error) {
+	return s.SubmitIdempotent("", user, value, policy, reason)
+}
+
+// SubmitIdempotent submits a score achieved by the user, as by SubmitWithReason.
+//
+// If a mutation with the same key was already applied, it returns the score of the user returned then,
+// with its current rank. An empty key is no key.
+func (s *Scores) SubmitIdempotent(key string, user int, value int, policy SubmitPolicy, reason string) (Submission, error) {
+	s.mu.Lock()
+	defer s.unlock()
+	at := s.expire()
+	if score, ok, err := s.duplicate(record{user: user, key: key}); err != nil {
+		return Submission{}, err
+	} else if ok {
+		sub := Submission{Score: score.Score, Version: score.Version}
+		if node, ok := s.users[user]; ok {
+			sub.Rank = s.rankOf(node)
+			sub.PreviousRank = sub.Rank
+		}
+		return sub, nil
+	}
+	r, err := s.submission(user, value, policy)
+	if err != nil {
+		return Submission{}, err
+	}
+	r.at, r.reason, r.key = at, reason, key
+	var sub Submission
+	node, ok := s.users[user]
+	if ok {
+		sub.PreviousRank = s.rankOf(node)
+		sub.Score = Score{User: user, Value: node.score}
+		sub.Version = node.seq
+	} else {
+		sub.Created = true
+	}
+	if r.op != 0 {
+		v, err := s.mutate(r)
+		if err != nil {
+			return Submission{}, err
+		}
+		sub.Score, sub.Version = v.Score, v.Version
+	}
+	sub.Rank = s.rankOf(s.users[user])
+	return sub, nil
+}
+
+// submission returns the mutation which applies the submitted score.
+//
+// The returned mutation has no operation if the score of the user does not change.
+func (s *Scores) submission(user int, value int, policy SubmitPolicy) (record, error) {
+	node, ok := s.users[user]
+	if !ok {
+		return record{op: opAdd, user: user, value: value}, nil
+	}
+	var delta int
+	switch policy {
+	case KeepBest:
+		if s.better(value, node.score) {
+			delta = value - node.score
+		}
+	case KeepLatest:
+		delta = value - node.score
+	case Accumulate:
+		delta = value
+	default:
+		return record{}, fmt.Errorf("unknown submit policy: %d", policy)
+	}
+	if delta == 0 {
+		return record{}, nil
+	}
+	return record{op: opUpdate, user: user, value: delta}, nil
+}
@@ -0,0 +1,63 @@
+package scores
+
+import (
+	"fmt"
+)
+
+// TieBreak decides how users with equal scores are ranked.
+type TieBreak int
+
+const (
+	// LastAchieverWins ranks higher the user that reached the score later.
+	LastAchieverWins TieBreak = iota
+	// FirstAchieverWins ranks higher the user that reached the score first.
+	FirstAchieverWins
+	// LowerUserWins ranks higher the user with the lower id.
+	LowerUserWins
+	// SharedRank gives users with equal scores the same rank, as in "1224" ranking.
+	// They are listed in the order of their ids.
+	SharedRank
+)
+
+var tieBreakNames = map[TieBreak]string{
+	LastAchieverWins:  "last",
+	FirstAchieverWins: "first",
+	LowerUserWins:     "user",
+	SharedRank:        "shared",
+}
+
+func (t TieBreak) String() string {
+	if name, ok := tieBreakNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TieBreak(%d)", int(t))
+}
+
+// ParseTieBreak returns the tie break with the given name, as returned by String.
+//
+// The empty name is LastAchieverWins.
+func ParseTieBreak(name string) (TieBreak, error) {
+	if name == "" {
+		return LastAchieverWins, nil
+	}
+	for t, tName := range tieBreakNames {
+		if tName == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown tie break: %q", name)
+}
+
+// below returns whether node a is ranked below node b, which means a goes to the left of b in our tree.
+func (s *Scores) below(a, b *Node) bool {
+	if a.score != b.score {
+		return s.better(b.score, a.score)
+	}
+	switch s.tieBreak {
+	case FirstAchieverWins:
+		return a.seq > b.seq
+	case LowerUserWins, SharedRank:
+		return a.user > b.user
+	}
+	return a.seq < b.seq
+}
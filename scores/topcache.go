@@ -0,0 +1,99 @@
+package scores
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TopCacheSize is how many of the best scores are cached, so top queries up to it do not walk the tree.
+//
+// The cache is built by the first top query after one of these scores changed,
+// so changes of the worse scores do not affect it.
+const TopCacheSize = 100
+
+// topCache keeps the best scores, between the changes of any of them.
+type topCache struct {
+	mu      sync.Mutex   // serializes building the cache, so concurrent queries build it only once
+	scores  atomic.Value // *topScores with the best scores of a version of the top scores, or nil if it was not built yet
+	id      string       // identifies the scores in the tags of the cache, so tags differ after a restart
+	version uint64       // incremented whenever one of the best scores changes, by mutations
+}
+
+// topScores are the best scores, from best to worst, of a version of the top scores.
+type topScores struct {
+	version uint64
+	scores  []Score
+}
+
+func newTopCache() *topCache {
+	c := &topCache{id: strconv.FormatInt(time.Now().UnixNano(), 36)}
+	c.scores.Store((*topScores)(nil))
+	return c
+}
+
+// TopTag returns a tag of the top scores which changes whenever one of them changes,
+// so clients can tell whether the top scores they got before are still the top scores.
+//
+// Only the tags of at most TopCacheSize scores are known, so it returns false for more.
+func (s *Scores) TopTag(top int) (string, bool) {
+	if top > TopCacheSize {
+		return "", false
+	}
+	return s.top.id + "." + strconv.FormatUint(s.current().top, 10), true
+}
+
+// cachedTop returns at most top of the best scores, from the cache if it has them.
+func (v view) cachedTop(top int) []Score {
+	if top > TopCacheSize {
+		if v.root == nil {
+			return nil
+		}
+		return v.root.Top(top)
+	}
+	best := v.s.top.scores.Load().(*topScores)
+	if best == nil || best.version != v.top {
+		best = v.s.top.build(v)
+	}
+	if top > len(best.scores) {
+		top = len(best.scores)
+	}
+	if top <= 0 {
+		return nil
+	}
+	// callers can change the returned scores, which must not change the cache
+	return append([]Score(nil), best.scores[:top]...)
+}
+
+// build builds the cache from the version v of the scores, unless another query built it in the meantime,
+// and returns the best scores.
+func (c *topCache) build(v view) *topScores {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if best := c.scores.Load().(*topScores); best != nil && best.version == v.top {
+		return best
+	}
+	best := &topScores{version: v.top}
+	if v.root != nil {
+		best.scores = v.root.Top(TopCacheSize)
+	}
+	c.scores.Store(best)
+	return best
+}
+
+// touch invalidates the cache if the node is among the best scores.
+//
+// The scores lock must be held for writing.
+func (s *Scores) touch(n *Node) {
+	if s.working().position(n) <= TopCacheSize {
+		s.top.invalidate()
+	}
+}
+
+// invalidate makes the cache out of date, by changing the version of the top scores.
+//
+// The scores lock must be held for writing.
+func (c *topCache) invalidate() {
+	c.version++
+}
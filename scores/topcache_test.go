@@ -0,0 +1,108 @@
+package scores
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTopCache tests that cached top scores are always the ones in the tree.
+func TestTopCache(t *testing.T) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	s := New()
+	n := 3 * TopCacheSize
+	for i := 0; i < 10000; i++ {
+		user := random.Intn(n)
+		switch random.Intn(3) {
+		case 0:
+			s.Add(Score{User: user, Value: random.Intn(1000)})
+		case 1:
+			s.Update(Score{User: user, Value: random.Intn(200) - 100})
+		case 2:
+			s.Remove(user)
+		}
+		top := random.Intn(TopCacheSize + 10)
+		expected := inOrder(s.root)
+		if top < len(expected) {
+			expected = expected[:top]
+		}
+		if calculated := s.Top(top); len(calculated) != len(expected) || (len(expected) > 0 && !reflect.DeepEqual(calculated, expected)) {
+			t.Fatalf("got top %d: \n%v\n expected: \n%v\n", top, calculated, expected)
+		}
+	}
+}
+
+// TestTopTag tests that the tag of the top scores changes only when one of them changes.
+func TestTopTag(t *testing.T) {
+	c := &clock{t: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)}
+	s := New(WithExpiry(time.Hour))
+	s.now = c.now
+	n := 2 * TopCacheSize
+	for i := 1; i <= n; i++ {
+		s.Add(Score{User: i, Value: 10 * i})
+	}
+	tag, ok := s.TopTag(10)
+	if !ok {
+		t.Fatalf("expected tag of the top scores")
+	}
+	if _, ok := s.TopTag(TopCacheSize + 1); ok {
+		t.Fatalf("expected no tag of more than %d scores", TopCacheSize)
+	}
+	assertTag := func(changed bool) {
+		t.Helper()
+		newTag, _ := s.TopTag(10)
+		if (newTag != tag) != changed {
+			t.Fatalf("got tag %q after %q, expected change: %v", newTag, tag, changed)
+		}
+		tag = newTag
+	}
+	// the worst scores do not change the tag
+	s.Update(Score{User: 1, Value: 5})
+	s.Add(Score{User: n + 1, Value: 1})
+	s.Remove(2)
+	assertTag(false)
+	s.Update(Score{User: 3, Value: 10 * n})
+	assertTag(true)
+	s.Remove(n)
+	assertTag(true)
+	if top := s.Top(1); top[0].User != 3 {
+		t.Fatalf("got top %v, expected user 3", top)
+	}
+	// expired top scores change the tag
+	c.t = c.t.Add(time.Hour)
+	assertTag(true)
+	if top := s.Top(10); len(top) != 0 {
+		t.Fatalf("got top %v, expected none", top)
+	}
+	assertTag(false)
+}
+
+// TestTopCacheConcurrent tests that concurrent top queries get the best scores while they change.
+func TestTopCacheConcurrent(t *testing.T) {
+	s := New()
+	for i := 1; i <= 2*TopCacheSize; i++ {
+		s.Add(Score{User: i, Value: i})
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				top := s.Top(10)
+				for j := 1; j < len(top); j++ {
+					if top[j].Value > top[j-1].Value {
+						t.Errorf("got unsorted top: %v", top)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		s.Update(Score{User: 1 + i%(2*TopCacheSize), Value: 1})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,187 @@
+package scores
+
+// The scores tree is a persistent AVL tree: the nodes published to queries are never changed.
+// An insert or removal copies the nodes on the path from the root to the modified node, recalculating
+// the metadata of each copy and rotating where the heights of the two subtrees differ by more than one,
+// so every published version of the tree shares its unchanged subtrees with the next one.
+// Nodes created since the last publish are not seen by queries, so they are changed in place instead.
+//
+// Rotations keep the in-order sequence of the nodes, so they keep the ranking as well,
+// but they change subtree sizes, which is why every rotated node calls fix.
+
+// insert links the unattached node n into the tree and rebalances the tree.
+func (s *Scores) insert(n *Node) {
+	n.left, n.right, n.gen = nil, nil, s.gen
+	s.root = s.insertAt(s.root, n)
+	s.changed = true
+	s.touch(n)
+}
+
+// insertAt inserts node n into the subtree rooted at t and returns the root of the new subtree.
+func (s *Scores) insertAt(t, n *Node) *Node {
+	if t == nil {
+		n.fix()
+		return n
+	}
+	t = s.own(t)
+	if s.below(n, t) {
+		t.left = s.insertAt(t.left, n)
+	} else {
+		t.right = s.insertAt(t.right, n)
+	}
+	return s.rebalance(t)
+}
+
+// remove unlinks node n from the tree and rebalances the tree.
+//
+// The node itself is not changed, so published versions of the tree keep it.
+func (s *Scores) remove(n *Node) {
+	s.touch(n)
+	s.root = s.removeAt(s.root, n)
+	s.changed = true
+}
+
+// removeAt removes node n from the subtree rooted at t and returns the root of the new subtree.
+func (s *Scores) removeAt(t, n *Node) *Node {
+	if t == nil {
+		return nil
+	}
+	switch {
+	case t == n:
+		if t.left == nil {
+			return t.right
+		}
+		if t.right == nil {
+			return t.left
+		}
+		// the replacement is the node ranked right after n in the right subtree
+		right, replacer := s.removeFirst(t.right)
+		replacer = s.own(replacer)
+		replacer.left, replacer.right = t.left, right
+		t = replacer
+	case s.below(n, t):
+		t = s.own(t)
+		t.left = s.removeAt(t.left, n)
+	default:
+		t = s.own(t)
+		t.right = s.removeAt(t.right, n)
+	}
+	return s.rebalance(t)
+}
+
+// removeFirst removes the leftmost node of the subtree rooted at t,
+// and returns the root of the new subtree together with the removed node.
+func (s *Scores) removeFirst(t *Node) (*Node, *Node) {
+	if t.left == nil {
+		return t.right, t
+	}
+	t = s.own(t)
+	var first *Node
+	t.left, first = s.removeFirst(t.left)
+	return s.rebalance(t), first
+}
+
+// own returns node n if it was created since the last publish, or else a copy of it which takes its place,
+// so changing the node does not change the published versions of the tree.
+func (s *Scores) own(n *Node) *Node {
+	if n.gen == s.gen {
+		return n
+	}
+	c := *n
+	c.gen = s.gen
+	if s.users[c.user] == n {
+		s.users[c.user] = &c
+	}
+	if s.ttl > 0 && c.index < len(s.expiry) && s.expiry[c.index] == n {
+		s.expiry[c.index] = &c
+	}
+	return &c
+}
+
+// rebalance fixes the metadata of node t, which must be owned, rotating it if it is unbalanced,
+// and returns the root of its subtree.
+func (s *Scores) rebalance(t *Node) *Node {
+	t.fix()
+	switch b := t.balance(); {
+	case b > 1:
+		if t.left.balance() < 0 {
+			t.left = s.rotateLeft(s.own(t.left))
+		}
+		return s.rotateRight(t)
+	case b < -1:
+		if t.right.balance() > 0 {
+			t.right = s.rotateRight(s.own(t.right))
+		}
+		return s.rotateLeft(t)
+	}
+	return t
+}
+
+// rotateLeft makes the right child of the owned node n the root of the subtree and returns it.
+func (s *Scores) rotateLeft(n *Node) *Node {
+	r := s.own(n.right)
+	n.right = r.left
+	r.left = n
+	n.fix()
+	r.fix()
+	return r
+}
+
+// rotateRight makes the left child of the owned node n the root of the subtree and returns it.
+func (s *Scores) rotateRight(n *Node) *Node {
+	l := s.own(n.left)
+	n.left = l.right
+	l.right = n
+	n.fix()
+	l.fix()
+	return l
+}
+
+// fix recalculates the metadata of this node from its children.
+func (s *Node) fix() {
+	s.lsize, s.rsize = s.left.size(), s.right.size()
+	s.height = 1 + max(s.left.getHeight(), s.right.getHeight())
+	s.leftmost, s.rightmost, s.distinct = s.score, s.score, 1
+	if s.left != nil {
+		s.leftmost = s.left.leftmost
+		s.distinct += s.left.distinct
+		if s.left.rightmost == s.score {
+			s.distinct--
+		}
+	}
+	if s.right != nil {
+		s.rightmost = s.right.rightmost
+		s.distinct += s.right.distinct
+		if s.right.leftmost == s.score {
+			s.distinct--
+		}
+	}
+}
+
+// balance returns the difference between the heights of the left and right subtrees.
+func (s *Node) balance() int {
+	return s.left.getHeight() - s.right.getHeight()
+}
+
+// size returns the number of nodes in the subtree rooted at s, which can be nil.
+func (s *Node) size() int {
+	if s == nil {
+		return 0
+	}
+	return s.lsize + s.rsize + 1
+}
+
+// getHeight returns the height of the subtree rooted at s, which can be nil.
+func (s *Node) getHeight() int {
+	if s == nil {
+		return 0
+	}
+	return s.height
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -2,6 +2,7 @@ package scores
 
 import (
 	"fmt"
+	"sync/atomic"
 )
 
 // Update updates score for existing user and returns new score.
@@ -9,140 +10,156 @@ import (
 // Returns new score.
 func (s *Scores) Update(score Score) (Score, error) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.users[score.User]; !ok {
-		return Score{}, fmt.Errorf("user cannot be found: %d", score.User)
-	}
-	if score.User == s.root.user {
-		return s.updateRoot(score)
-	}
-	node := s.users[score.User]
-	node.replace()
-	score.Value += node.score
-	node = s.root.Add(score)
-	s.users[score.User] = node
-	return score, nil
+	defer s.unlock()
+	v, err := s.mutate(record{op: opUpdate, user: score.User, value: score.Value})
+	return v.Score, err
 }
 
-// updateRoot updates root node with new score.
-// Returns new score.
-func (s *Scores) updateRoot(score Score) (Score, error) {
-	score.Value += s.root.score
-	if s.root.left == nil && s.root.right == nil {
-		s.root.score = score.Value
-		return score, nil
-	}
-	oldRoot := s.root
-	defer oldRoot.nullify()
-	if s.root.right == nil {
-		s.root = s.root.left
-	} else if s.root.left == nil {
-		s.root = s.root.right
-	} else {
-		s.root = s.root.replaceWithDescendant()
-	}
-	delete(s.users, score.User)
-	s.users[score.User] = s.root.Add(score)
-	return score, nil
+// Remove removes the user and its score.
+func (s *Scores) Remove(user int) error {
+	s.mu.Lock()
+	defer s.unlock()
+	_, err := s.mutate(record{op: opRemove, user: user})
+	return err
 }
 
-// replace replaces this node with another one, such that BST property is preserved.
+// mutate validates the mutation, appends it to the log and then applies it.
 //
-// returns the replacement, which is nil if s is a leaf node.
-func (s *Node) replace() *Node {
-	defer s.nullify()
-	if s.left == nil && s.right == nil {
-		replaceParentConnection(s, nil)
-		return nil
+// Returns the new score of the user, with its version.
+func (s *Scores) mutate(r record) (VersionedScore, error) {
+	if score, ok, err := s.duplicate(r); ok || err != nil {
+		return score, err
+	}
+	if r.at == 0 {
+		r.at = s.expire()
 	}
-	if s.left == nil {
-		replaceParentConnection(s, s.right)
-		return s.right
+	if err := s.validate(r); err != nil {
+		return VersionedScore{}, err
 	}
-	if s.right == nil {
-		replaceParentConnection(s, s.left)
-		return s.left
+	if s.sequence != nil && (r.op == opAdd || r.op == opUpdate) {
+		r.seq = atomic.AddUint64(s.sequence, 1)
 	}
-	return s.replaceWithDescendant()
+	if err := s.journal(r); err != nil {
+		return VersionedScore{}, err
+	}
+	return s.commit(r), nil
 }
 
-// right replaces this node from the tree with a new one such that BST property is preserved.
-//
-// It returns the new node.
+// commit applies a logged mutation, remembering it in the history and the dedup table.
 //
-// The node must have both children.
-func (s *Node) replaceWithDescendant() *Node {
-	defer s.nullify()
-	if s.right.left == nil {
-		replacer := s.right
-		replacer.left = s.left
-		replacer.lsize = s.lsize
-		if s.parent != nil {
-			replaceParentConnection(s, replacer)
-		}
-		return replacer
+// Returns the new score of the user, with its version.
+func (s *Scores) commit(r record) VersionedScore {
+	var before int
+	if node, ok := s.users[r.user]; ok {
+		before = node.score
 	}
-	replacer := s.right.walkLeft()
-	replaceParentConnection(replacer, replacer.right)
-	replaceNode(s, replacer)
-	return replacer
+	score := VersionedScore{Score: s.apply(r)}
+	if node, ok := s.users[r.user]; ok {
+		score.Version = node.seq
+	}
+	s.remember(r, before, score.Value)
+	s.dedup.add(r.key, score)
+	return score
 }
 
-// subtractSize subtracts size from ancestors of this node.
-func (s *Node) subtractSize(size int) {
-	if size == 0 || s.parent == nil {
-		return
-	}
-	// identify if the parent is to the left or right
-	if s.parent.left != nil && s.parent.left.user == s.user {
-		s.parent.lsize -= size
-	} else {
-		s.parent.rsize -= size
+// validate returns an error if the mutation cannot be applied to the scores.
+func (s *Scores) validate(r record) error {
+	var version uint64
+	node, ok := s.users[r.user]
+	if ok {
+		version = node.seq
 	}
-	s.parent.subtractSize(size)
+	return validateRecord(r, ok, version)
 }
 
-// walkLeft walks to the left of this node all the way and returns the last node.
-func (s *Node) walkLeft() *Node {
-	if s.left == nil {
-		return s
+// validateRecord returns an error if the mutation cannot be applied to a user,
+// which has a score with the given version if exists is true.
+func validateRecord(r record, exists bool, version uint64) error {
+	switch r.op {
+	case opAdd:
+		if exists {
+			return fmt.Errorf("Existing user: %d", r.user)
+		}
+	case opErase:
+		// the user can have a history without a score
+	case opUpdate, opRemove:
+		if !exists {
+			return fmt.Errorf("%w: %d", ErrUserNotFound, r.user)
+		}
+		if r.version != 0 && r.version != version {
+			return fmt.Errorf("%w: user %d has version %d, not %d", ErrVersionMismatch, r.user, version, r.version)
+		}
+	default:
+		return fmt.Errorf("unknown operation: %d", r.op)
+	}
+	if len(r.reason) > MaxReasonSize {
+		return fmt.Errorf("reason longer than %d bytes", MaxReasonSize)
+	}
+	if len(r.key) > MaxKeySize {
+		return fmt.Errorf("idempotency key longer than %d bytes", MaxKeySize)
 	}
-	return s.left.walkLeft()
+	return nil
 }
 
-// nullify removes all pointers of this node.
+// apply applies a valid mutation to the scores.
 //
-// You may need to call this method after you remove the node from the tree.
-func (s *Node) nullify() {
-	s.left, s.right, s.parent = nil, nil, nil
-}
-
-// replaceParentConnection replaces the connection between s's parent to s with s's parent to newChild.
-// we assume that s has a parent.
-func replaceParentConnection(s *Node, newChild *Node) {
-	var newSize int
-	if newChild != nil {
-		newSize = newChild.lsize + newChild.rsize + 1
-	}
-	subtractedSize := s.parent.lsize + s.parent.rsize
-	if s.parent.left != nil && s.parent.left.user == s.user {
-		s.parent.left = newChild
-		s.parent.lsize = newSize
-		return
+// Returns the new score of the user.
+func (s *Scores) apply(r record) Score {
+	switch r.op {
+	case opAdd:
+		node := &Node{
+			score: r.value,
+			user:  r.user,
+			seq:   s.nextSeq(r),
+			at:    r.at,
+		}
+		s.insert(node)
+		s.users[r.user] = node
+		s.indexUser(node)
+		s.track(node)
+		return Score{User: r.user, Value: r.value}
+	case opUpdate:
+		old := s.users[r.user]
+		if r.value == 0 {
+			// the user did not achieve a new score, so it keeps its place among equal scores
+			return Score{User: old.user, Value: old.score}
+		}
+		s.remove(old)
+		// published versions of the tree keep the old node, so the new score goes to a new one
+		node := &Node{
+			score: old.score + r.value,
+			user:  old.user,
+			seq:   s.nextSeq(r),
+			at:    r.at,
+		}
+		s.insert(node)
+		s.users[r.user] = node
+		s.indexUser(node)
+		s.retrack(old, node)
+		return Score{User: node.user, Value: node.score}
+	case opRemove, opErase:
+		node, ok := s.users[r.user]
+		if !ok {
+			break
+		}
+		s.remove(node)
+		s.untrack(node)
+		delete(s.users, r.user)
+		s.unindexUser(r.user)
 	}
-	s.parent.right = newChild
-	s.parent.rsize = newSize
-	s.parent.subtractSize(subtractedSize - (s.parent.lsize + s.parent.rsize))
+	return Score{User: r.user}
 }
 
-// replaceNode replaces node s with node n.
-// you need to make sure after this call,
-func replaceNode(s *Node, n *Node) {
-	n.right = s.right
-	n.rsize = s.rsize
-	n.left = s.left
-	n.lsize = s.lsize
-	if s.parent != nil {
-		replaceParentConnection(s, n)
+// nextSeq returns the sequence number of the score achieved by the mutation.
+//
+// It is the next one of the scores, unless the mutation has its own, shared with other scores.
+func (s *Scores) nextSeq(r record) uint64 {
+	if r.seq == 0 {
+		s.seq++
+		return s.seq
+	}
+	if r.seq > s.seq {
+		s.seq = r.seq
 	}
+	return r.seq
 }
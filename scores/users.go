@@ -0,0 +1,167 @@
+package scores
+
+import "sort"
+
+// Queries read published versions of the tree, which are not the current one, so they cannot use the map of users
+// to find the node of a user. Instead, every version has an index of the users: a persistent AVL tree ordered by user,
+// with the key of the node of every user, which is copied on the same path as the scores tree.
+
+// userNode is a node of the index of the users.
+type userNode struct {
+	user        int
+	score       int    // score of the node of the user
+	seq         uint64 // sequence number of the node of the user
+	left, right *userNode
+	height      int
+	gen         uint64 // as for Node
+}
+
+// indexUser sets the key of the node n of a user in the index of the users.
+func (s *Scores) indexUser(n *Node) {
+	s.userIndex = s.setUser(s.userIndex, n)
+	s.changed = true
+}
+
+// unindexUser removes the user from the index of the users.
+func (s *Scores) unindexUser(user int) {
+	s.userIndex = s.deleteUser(s.userIndex, user)
+	s.changed = true
+}
+
+// setUser sets the key of the node n in the index rooted at t and returns the root of the new index.
+func (s *Scores) setUser(t *userNode, n *Node) *userNode {
+	if t == nil {
+		return &userNode{user: n.user, score: n.score, seq: n.seq, height: 1, gen: s.gen}
+	}
+	t = s.ownUser(t)
+	switch {
+	case n.user < t.user:
+		t.left = s.setUser(t.left, n)
+	case n.user > t.user:
+		t.right = s.setUser(t.right, n)
+	default:
+		t.score, t.seq = n.score, n.seq
+		return t
+	}
+	return s.rebalanceUser(t)
+}
+
+// deleteUser removes the user from the index rooted at t and returns the root of the new index.
+func (s *Scores) deleteUser(t *userNode, user int) *userNode {
+	if t == nil {
+		return nil
+	}
+	switch {
+	case user < t.user:
+		t = s.ownUser(t)
+		t.left = s.deleteUser(t.left, user)
+	case user > t.user:
+		t = s.ownUser(t)
+		t.right = s.deleteUser(t.right, user)
+	default:
+		if t.left == nil {
+			return t.right
+		}
+		if t.right == nil {
+			return t.left
+		}
+		right, replacer := s.deleteFirstUser(t.right)
+		replacer = s.ownUser(replacer)
+		replacer.left, replacer.right = t.left, right
+		t = replacer
+	}
+	return s.rebalanceUser(t)
+}
+
+// deleteFirstUser removes the leftmost node of the index rooted at t,
+// and returns the root of the new index together with the removed node.
+func (s *Scores) deleteFirstUser(t *userNode) (*userNode, *userNode) {
+	if t.left == nil {
+		return t.right, t
+	}
+	t = s.ownUser(t)
+	var first *userNode
+	t.left, first = s.deleteFirstUser(t.left)
+	return s.rebalanceUser(t), first
+}
+
+// ownUser returns node n if it was created since the last publish, or else a copy of it, as by Scores.own.
+func (s *Scores) ownUser(n *userNode) *userNode {
+	if n.gen == s.gen {
+		return n
+	}
+	c := *n
+	c.gen = s.gen
+	return &c
+}
+
+// rebalanceUser fixes the height of the owned node t, rotating it if it is unbalanced,
+// and returns the root of its subtree.
+func (s *Scores) rebalanceUser(t *userNode) *userNode {
+	t.fix()
+	switch b := t.left.getHeight() - t.right.getHeight(); {
+	case b > 1:
+		if t.left.left.getHeight() < t.left.right.getHeight() {
+			t.left = s.rotateUserLeft(s.ownUser(t.left))
+		}
+		return s.rotateUserRight(t)
+	case b < -1:
+		if t.right.left.getHeight() > t.right.right.getHeight() {
+			t.right = s.rotateUserRight(s.ownUser(t.right))
+		}
+		return s.rotateUserLeft(t)
+	}
+	return t
+}
+
+// rotateUserLeft makes the right child of the owned node n the root of the subtree and returns it.
+func (s *Scores) rotateUserLeft(n *userNode) *userNode {
+	r := s.ownUser(n.right)
+	n.right = r.left
+	r.left = n
+	n.fix()
+	r.fix()
+	return r
+}
+
+// rotateUserRight makes the left child of the owned node n the root of the subtree and returns it.
+func (s *Scores) rotateUserRight(n *userNode) *userNode {
+	l := s.ownUser(n.left)
+	n.left = l.right
+	l.right = n
+	n.fix()
+	l.fix()
+	return l
+}
+
+// fix recalculates the height of this node from its children.
+func (u *userNode) fix() {
+	u.height = 1 + max(u.left.getHeight(), u.right.getHeight())
+}
+
+// getHeight returns the height of the subtree rooted at u, which can be nil.
+func (u *userNode) getHeight() int {
+	if u == nil {
+		return 0
+	}
+	return u.height
+}
+
+// buildUsers returns a perfectly balanced index of the users of the nodes.
+func (s *Scores) buildUsers(nodes []*Node) *userNode {
+	sorted := append([]*Node(nil), nodes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].user < sorted[j].user })
+	var build func(nodes []*Node) *userNode
+	build = func(nodes []*Node) *userNode {
+		if len(nodes) == 0 {
+			return nil
+		}
+		mid := len(nodes) / 2
+		n := nodes[mid]
+		u := &userNode{user: n.user, score: n.score, seq: n.seq, gen: s.gen}
+		u.left, u.right = build(nodes[:mid]), build(nodes[mid+1:])
+		u.fix()
+		return u
+	}
+	return build(sorted)
+}
@@ -0,0 +1,215 @@
+package scores
+
+// view is a published version of the scores. Its tree is never changed, so queries read it without locks.
+//
+// Mutations change a new version of the tree, which shares the unchanged subtrees with the published one,
+// and publish it when they unlock the scores, so queries see either all or none of the changes of a mutation.
+type view struct {
+	s        *Scores // the scores, for their order and tie break
+	root     *Node
+	users    *userNode // index of the users
+	len      int
+	top      uint64 // version of the top scores
+	deadline int64  // when the next score expires, as unix nanoseconds, or 0 if no score expires
+}
+
+// publish makes the changes of the tree since the last publish visible to queries.
+//
+// The scores lock must be held for writing.
+func (s *Scores) publish() {
+	if !s.changed {
+		return
+	}
+	v := &view{s: s, root: s.root, users: s.userIndex, len: len(s.users), top: s.top.version}
+	if s.ttl > 0 && len(s.expiry) > 0 {
+		v.deadline = s.expiry[0].at + int64(s.ttl)
+	}
+	s.published.Store(v)
+	// the published nodes must be copied from now on
+	s.gen++
+	s.changed = false
+}
+
+// unlock publishes the changes of the tree, if there are any, and unlocks the scores locked for writing.
+func (s *Scores) unlock() {
+	s.publish()
+	s.mu.Unlock()
+}
+
+// current returns the published version of the scores, after removing the expired scores, if there are any.
+func (s *Scores) current() *view {
+	v := s.published.Load().(*view)
+	if v.deadline == 0 || v.deadline > s.now().UnixNano() {
+		return v
+	}
+	s.mu.Lock()
+	s.expire()
+	s.unlock()
+	return s.published.Load().(*view)
+}
+
+// working returns the version of the scores being changed, which is the published one unless the scores
+// are locked for writing.
+//
+// The scores lock must be held, at least for reading.
+func (s *Scores) working() view {
+	return view{s: s, root: s.root, users: s.userIndex, len: len(s.users), top: s.top.version}
+}
+
+// find returns the node of the user, with its ordinal rank, starting from 1, and whether the user has a node.
+func (v view) find(user int) (*Node, int, bool) {
+	u := v.users
+	for u != nil && u.user != user {
+		if user < u.user {
+			u = u.left
+		} else {
+			u = u.right
+		}
+	}
+	if u == nil {
+		return nil, 0, false
+	}
+	key := Node{score: u.score, seq: u.seq, user: u.user}
+	above := 0
+	for n := v.root; n != nil; {
+		switch {
+		case n.user == user:
+			return n, above + n.rsize + 1, true
+		case v.s.below(&key, n):
+			// the node and its right subtree are above the user
+			above += n.rsize + 1
+			n = n.left
+		default:
+			n = n.right
+		}
+	}
+	return nil, 0, false
+}
+
+// position returns the ordinal rank of the node, starting from 1.
+func (v view) position(n *Node) int {
+	return v.countAbove(n) + 1
+}
+
+// rankOf returns the rank of the node, which has the given position, according to mode.
+func (v view) rankOf(n *Node, position int, mode RankMode) int {
+	switch mode {
+	case CompetitionRank:
+		return v.countBetter(n.score) + 1
+	case DenseRank:
+		return v.countDistinctBetter(n.score) + 1
+	}
+	return position
+}
+
+// rank annotates consecutive scores with their rank, according to mode.
+//
+// start is the position of the first score.
+func (v view) rank(scores []Score, start int, mode RankMode) []RankedScore {
+	return rank(scores, start, mode, v.countBetter, v.countDistinctBetter)
+}
+
+// countAbove returns the number of nodes ranked above the node key, which need not be in the tree.
+func (v view) countAbove(key *Node) int {
+	count := 0
+	for n := v.root; n != nil; {
+		if v.s.below(key, n) {
+			// the node and its right subtree are above, the left subtree can have some too
+			count += n.rsize + 1
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return count
+}
+
+// countBetter returns the number of scores strictly better than value.
+func (v view) countBetter(value int) int {
+	count := 0
+	for n := v.root; n != nil; {
+		if v.s.better(n.score, value) {
+			// the node and its right subtree are better, the left subtree can have better ones too
+			count += n.rsize + 1
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return count
+}
+
+// countDistinctBetter returns the number of distinct scores strictly better than value.
+//
+// The better scores are split in subtrees and nodes, which we visit in rank order,
+// so equal scores can be counted only once when they are split between two consecutive parts.
+func (v view) countDistinctBetter(value int) int {
+	var (
+		count int
+		last  *int // the worst score counted so far
+	)
+	for n := v.root; n != nil; {
+		if !v.s.better(n.score, value) {
+			n = n.right
+			continue
+		}
+		if r := n.right; r != nil {
+			count += r.distinct
+			if last != nil && *last == r.rightmost {
+				count--
+			}
+			last = &r.leftmost
+		}
+		if last == nil || *last != n.score {
+			count++
+		}
+		last = &n.score
+		n = n.left
+	}
+	return count
+}
+
+// nextBetter returns the worst score strictly better than value, and whether there is one.
+func (v view) nextBetter(value int) (int, bool) {
+	var (
+		next  int
+		found bool
+	)
+	for n := v.root; n != nil; {
+		if v.s.better(n.score, value) {
+			next, found = n.score, true
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return next, found
+}
+
+// nextAbove returns the worst node ranked above the node key, which need not be in the tree, or nil if there is none.
+func (v view) nextAbove(key *Node) *Node {
+	var next *Node
+	for n := v.root; n != nil; {
+		if v.s.below(key, n) {
+			next = n
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return next
+}
+
+// nextBelow returns the best node ranked below the node key, which need not be in the tree, or nil if there is none.
+func (v view) nextBelow(key *Node) *Node {
+	var next *Node
+	for n := v.root; n != nil; {
+		if v.s.below(n, key) {
+			next = n
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return next
+}
@@ -0,0 +1,78 @@
+package scores
+
+// walkChunk is how many scores Walk reads from a version of the scores.
+const walkChunk = 1000
+
+// Walk calls fn with the scores from best to worst, starting with the one ranked from, starting from 1,
+// until fn returns false or there are no more scores.
+//
+// The scores are annotated with their rank, according to the rank mode of the scores.
+// They are read in chunks, every chunk from the version of the scores published when it is read,
+// so Walk does not keep old versions of the scores while fn runs.
+// Every chunk continues with the score ranked right after the last score of the previous one,
+// so the scores which do not change during the walk are seen exactly once, in order,
+// while a score which changes may be seen at both its old and new rank, or at neither.
+func (s *Scores) Walk(from int, fn func(RankedScore) bool) {
+	if from < 1 {
+		from = 1
+	}
+	var last *Node // copy of the last score of the previous chunk
+	for {
+		chunk, next := s.walkChunk(from, last)
+		for _, score := range chunk {
+			if !fn(score) {
+				return
+			}
+		}
+		if next == nil {
+			return
+		}
+		last = next
+	}
+}
+
+// walkChunk returns the next chunk of Walk, starting with the score ranked from if last is nil,
+// or with the score ranked right after last otherwise.
+//
+// It also returns a copy of the last score of the chunk, or nil if there are no more scores.
+func (s *Scores) walkChunk(from int, last *Node) ([]RankedScore, *Node) {
+	v := s.current()
+	start := from
+	if last != nil {
+		n := v.nextBelow(last)
+		if n == nil {
+			return nil, nil
+		}
+		start = v.position(n)
+	}
+	if start > v.len {
+		return nil, nil
+	}
+	end := start + walkChunk - 1
+	if end >= v.len {
+		end = v.len
+		last = nil
+	} else {
+		n := v.root.nodeAt(end)
+		last = &Node{score: n.score, user: n.user, seq: n.seq}
+	}
+	scores := make([]Score, 0, end-start+1)
+	v.root.search(1, start, end, &scores)
+	return v.rank(scores, start, s.RankMode()), last
+}
+
+// nodeAt returns the node ranked rank in the tree of this node, starting from 1, or nil if there is none.
+func (s *Node) nodeAt(rank int) *Node {
+	for n := s; n != nil; {
+		switch r := n.rsize + 1; {
+		case rank == r:
+			return n
+		case rank < r:
+			n = n.right
+		default:
+			rank -= r
+			n = n.left
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package scores
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestWalk tests that walking the scores returns them in rank order, across several chunks.
+func TestWalk(t *testing.T) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for _, tieBreak := range []TieBreak{LastAchieverWins, FirstAchieverWins, LowerUserWins, SharedRank} {
+		s := New(WithTieBreak(tieBreak))
+		n := 2*walkChunk + 10
+		for i := 0; i < n; i++ {
+			s.Add(Score{User: i, Value: random.Intn(100)})
+		}
+		for _, from := range []int{0, 1, walkChunk, n, n + 1} {
+			expected := s.RangeRanked(n, n, s.RankMode())
+			if from > 1 {
+				expected = expected[from-1:]
+			}
+			var calculated []RankedScore
+			s.Walk(from, func(score RankedScore) bool {
+				calculated = append(calculated, score)
+				return true
+			})
+			if len(expected) == 0 && len(calculated) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(calculated, expected) {
+				t.Fatalf("%v: got walk from %d: \n%v\n expected: \n%v\n", tieBreak, from, calculated, expected)
+			}
+		}
+		var count int
+		s.Walk(1, func(RankedScore) bool {
+			count++
+			return count < 5
+		})
+		if count != 5 {
+			t.Fatalf("%v: got %d scores after stopping the walk, expected: 5", tieBreak, count)
+		}
+	}
+}
+
+// TestWalkChanging tests that scores which do not change during the walk are seen exactly once, in order.
+func TestWalkChanging(t *testing.T) {
+	s := New()
+	n := 3 * walkChunk
+	for i := 0; i < n; i++ {
+		s.Add(Score{User: i, Value: 2 * i})
+	}
+	var (
+		calculated []Score
+		changed    int
+	)
+	s.Walk(1, func(score RankedScore) bool {
+		calculated = append(calculated, score.Score)
+		if len(calculated)%walkChunk == walkChunk/2 {
+			// move an odd score among the ones already seen, and another one among the ones not seen yet
+			s.Add(Score{User: n + changed, Value: 2*n + 1})
+			s.Add(Score{User: 2*n + changed, Value: 1})
+			changed++
+		}
+		return true
+	})
+	var unchanged []Score
+	for _, score := range calculated {
+		if score.User < n {
+			unchanged = append(unchanged, score)
+		}
+	}
+	if len(unchanged) != n {
+		t.Fatalf("got %d unchanged scores, expected: %d", len(unchanged), n)
+	}
+	for i, score := range unchanged {
+		if score.User != n-1-i {
+			t.Fatalf("got score %v at position %d, expected user %d", score, i, n-1-i)
+		}
+	}
+}
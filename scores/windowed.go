@@ -0,0 +1,340 @@
+package scores
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrArchived is returned when changing the scores of a period that has ended.
+var ErrArchived = errors.New("period is archived")
+
+// Windowed keeps separate scores for every period, such as every day or every week,
+// so users compete again from scratch when a period ends.
+//
+// Scores are submitted together with the time they were achieved at, and they go to the period
+// containing that time. The first submission in a new period archives the scores of the previous
+// periods, which cannot be changed anymore, but can still be queried, until there are more than
+// retention archived periods and the oldest ones are deleted.
+//
+// Thread safe. Changing and querying the scores of a period only takes the read lock,
+// the write lock is taken only to start a new period and to close the scores.
+type Windowed struct {
+	mu        sync.RWMutex
+	period    Period
+	loc       *time.Location // location of the calendar boundaries of the periods
+	retention int            // how many archived periods are kept
+	options   []Option
+	path      string    // if not empty, the scores of every period are persisted at path.period.start
+	start     time.Time // start of the current period
+	current   *Scores
+	archived  map[string]*Scores // scores of the previous periods, by key
+	empty     *Scores            // scores of the periods without scores, so their top tag does not change
+	closed    bool
+}
+
+// NewWindowed returns windowed scores, which are kept only in memory, keeping retention archived periods.
+func NewWindowed(period Period, loc *time.Location, retention int, options ...Option) *Windowed {
+	empty := New(options...)
+	empty.Close()
+	return &Windowed{
+		period: period, loc: loc, retention: retention, options: options, archived: make(map[string]*Scores), empty: empty,
+	}
+}
+
+// OpenWindowed returns the windowed scores persisted at path, creating them if they do not exist.
+//
+// The scores of every period are opened as by Open, at path.period.start, where period is the name of the period
+// and start is the date when it starts, such as path.weekly.2021-03-01.
+// The periods older than the latest one and the retention archived ones before it are deleted, without opening them.
+func OpenWindowed(path string, period Period, loc *time.Location, retention int, options ...Option) (*Windowed, error) {
+	w := NewWindowed(period, loc, retention, options...)
+	w.path = path
+	paths, err := filepath.Glob(path + "." + period.String() + ".*" + LogExt)
+	if err != nil {
+		return nil, err
+	}
+	var starts []time.Time
+	for _, p := range paths {
+		date := strings.TrimSuffix(strings.TrimPrefix(p, path+"."+period.String()+"."), LogExt)
+		start, err := time.ParseInLocation("2006-01-02", date, loc)
+		if err != nil || !period.Start(start, loc).Equal(start) {
+			// not the scores of a period
+			continue
+		}
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	for i, start := range starts {
+		if i < len(starts)-retention-1 {
+			if err := w.remove(period.key(start)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		s, err := Open(path+"."+period.key(start), options...)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		if w.current != nil {
+			if err := w.archive(w.start, w.current); err != nil {
+				s.Close()
+				w.Close()
+				return nil, err
+			}
+		}
+		w.current, w.start = s, start
+	}
+	return w, nil
+}
+
+// Period returns the period of the scores.
+func (w *Windowed) Period() Period {
+	return w.period
+}
+
+// Submit submits a score achieved by the user at the given time, as by Scores.SubmitIdempotent.
+//
+// The score goes to the period containing the time, and returns ErrArchived if that period has ended.
+func (w *Windowed) Submit(key string, user int, value int, policy SubmitPolicy, at time.Time) (Submission, error) {
+	for {
+		s, err := w.writable(at)
+		if err != nil {
+			return Submission{}, err
+		}
+		sub, err := s.SubmitIdempotent(key, user, value, policy, "")
+		if !errors.Is(err, ErrClosed) {
+			return sub, err
+		}
+	}
+}
+
+// SubmitBatch submits the scores of the mutations achieved at the given time, all of them or none of them,
+// as by Scores.AccumulateBatch.
+//
+// The scores go to the period containing the time, and it returns ErrArchived if that period has ended.
+func (w *Windowed) SubmitBatch(mutations []Mutation, at time.Time) ([]VersionedScore, error) {
+	for {
+		s, err := w.writable(at)
+		if err != nil {
+			return nil, err
+		}
+		results, err := s.AccumulateBatch(mutations)
+		if !errors.Is(err, ErrClosed) {
+			return results, err
+		}
+	}
+}
+
+// Remove removes the user and its score from the period containing the given time, as by Scores.RemoveIdempotent.
+func (w *Windowed) Remove(key string, user int, at time.Time) error {
+	for {
+		s, err := w.writable(at)
+		if err != nil {
+			return err
+		}
+		if err := s.RemoveIdempotent(key, user); !errors.Is(err, ErrClosed) {
+			return err
+		}
+	}
+}
+
+// Erase erases the user from the scores of all periods, as by Scores.Erase.
+//
+// The erasure is logged by the current period, while the archived periods are rewritten without the user,
+// so they do not keep its changes on the disk. Starting a new period waits for the archived ones to be rewritten.
+func (w *Windowed) Erase(user int) error {
+	w.mu.RLock()
+	current := w.current
+	w.mu.RUnlock()
+	if current != nil {
+		// if the period was archived in the meantime, the user is erased below with the other archived periods
+		if err := current.Erase(user); err != nil && !errors.Is(err, ErrClosed) {
+			return err
+		}
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrClosed
+	}
+	for _, s := range w.archived {
+		if err := s.purge(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// At returns the scores of the period which is offset periods after the one containing t,
+// so an offset of -1 returns the scores of the previous period.
+//
+// Periods without scores return empty scores. The returned scores cannot be changed.
+func (w *Windowed) At(t time.Time, offset int) *Scores {
+	key := w.period.key(w.period.shift(w.period.Start(t, w.loc), offset))
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.current != nil && key == w.period.key(w.start) {
+		return w.current
+	}
+	if s, ok := w.archived[key]; ok {
+		return s
+	}
+	return w.empty
+}
+
+// Checkpoint checkpoints the scores of the current period, as by Scores.Checkpoint.
+//
+// It does nothing if the scores are not persisted.
+func (w *Windowed) Checkpoint() error {
+	w.mu.RLock()
+	s := w.current
+	w.mu.RUnlock()
+	if w.path == "" || s == nil {
+		return nil
+	}
+	if err := s.Checkpoint(); err != nil {
+		w.mu.RLock()
+		defer w.mu.RUnlock()
+		if s != w.current {
+			// the period was archived in the meantime
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Sweep removes the expired scores of all periods, as by Scores.Sweep, returning their number.
+func (w *Windowed) Sweep() int {
+	w.mu.RLock()
+	periods := make([]*Scores, 0, len(w.archived)+1)
+	if w.current != nil {
+		periods = append(periods, w.current)
+	}
+	for _, s := range w.archived {
+		periods = append(periods, s)
+	}
+	w.mu.RUnlock()
+	var n int
+	for _, s := range periods {
+		n += s.Sweep()
+	}
+	return n
+}
+
+// Close closes the scores of all periods.
+func (w *Windowed) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	var err error
+	if w.current != nil {
+		err = w.current.Close()
+	}
+	for _, s := range w.archived {
+		if closeErr := s.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// writable returns the scores of the period containing the time at, starting a new period if at is after the current one.
+//
+// The returned scores are closed if their period is archived before they are changed,
+// and the change then fails with ErrClosed, so it must be retried with the scores returned again.
+func (w *Windowed) writable(at time.Time) (*Scores, error) {
+	start := w.period.Start(at, w.loc)
+	w.mu.RLock()
+	current, currentStart, closed := w.current, w.start, w.closed
+	w.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if current != nil && start.Equal(currentStart) {
+		return current, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, ErrClosed
+	}
+	return w.rotate(start)
+}
+
+// rotate returns the scores of the period starting at start, archiving the current period if start is after it.
+//
+// w.mu must be held.
+func (w *Windowed) rotate(start time.Time) (*Scores, error) {
+	if w.current != nil && start.Equal(w.start) {
+		return w.current, nil
+	}
+	if w.current != nil && start.Before(w.start) {
+		return nil, fmt.Errorf("%w: %s", ErrArchived, start.Format("2006-01-02"))
+	}
+	s := New(w.options...)
+	if w.path != "" {
+		var err error
+		if s, err = Open(w.path+"."+w.period.key(start), w.options...); err != nil {
+			return nil, err
+		}
+	}
+	if w.current != nil {
+		if w.path != "" {
+			if err := w.current.Checkpoint(); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+		if err := w.archive(w.start, w.current); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	w.current, w.start = s, start
+	return s, nil
+}
+
+// archive closes the scores of the period starting at start, keeping them for queries,
+// and deletes the oldest archived periods beyond the retention.
+func (w *Windowed) archive(start time.Time, s *Scores) error {
+	// every mutation is already synced to the log, so an error closing it does not lose scores
+	s.Close()
+	w.archived[w.period.key(start)] = s
+	if len(w.archived) <= w.retention {
+		return nil
+	}
+	keys := make([]string, 0, len(w.archived))
+	for key := range w.archived {
+		keys = append(keys, key)
+	}
+	// the keys of the periods sort as their dates
+	sort.Strings(keys)
+	for _, key := range keys[:len(keys)-w.retention] {
+		delete(w.archived, key)
+		if err := w.remove(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove deletes the files of the scores of the period with the given key, if they are persisted.
+func (w *Windowed) remove(key string) error {
+	if w.path == "" {
+		return nil
+	}
+	for _, ext := range []string{LogExt, SnapshotExt} {
+		if err := os.Remove(w.path + "." + key + ext); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
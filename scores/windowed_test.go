@@ -0,0 +1,239 @@
+package scores
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPeriodStart tests the calendar boundaries of the periods.
+func TestPeriodStart(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Sunday evening in UTC is already Monday in Bucharest
+	at := time.Date(2021, time.March, 28, 22, 30, 0, 0, time.UTC)
+	testCases := []struct {
+		period   Period
+		loc      *time.Location
+		expected time.Time
+	}{
+		{Daily, time.UTC, time.Date(2021, time.March, 28, 0, 0, 0, 0, time.UTC)},
+		{Daily, loc, time.Date(2021, time.March, 29, 0, 0, 0, 0, loc)},
+		{Weekly, time.UTC, time.Date(2021, time.March, 22, 0, 0, 0, 0, time.UTC)},
+		{Weekly, loc, time.Date(2021, time.March, 29, 0, 0, 0, 0, loc)},
+		{Monthly, loc, time.Date(2021, time.March, 1, 0, 0, 0, 0, loc)},
+		{AllTime, loc, time.Time{}},
+	}
+	for _, tc := range testCases {
+		if calculated := tc.period.Start(at, tc.loc); !calculated.Equal(tc.expected) {
+			t.Fatalf("got start of %s period in %s: %v, expected: %v", tc.period, tc.loc, calculated, tc.expected)
+		}
+	}
+	// the daylight saving time started on March 28, so that day had only 23 hours
+	if calculated, expected := Daily.shift(time.Date(2021, time.March, 28, 0, 0, 0, 0, loc), -1), time.Date(2021, time.March, 27, 0, 0, 0, 0, loc); !calculated.Equal(expected) {
+		t.Fatalf("got previous day: %v, expected: %v", calculated, expected)
+	}
+}
+
+// TestWindowed tests that scores go to the period they were achieved in,
+// that ended periods are archived, and that the periods are restored after reopening.
+func TestWindowed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	w, err := OpenWindowed(path, Weekly, time.UTC, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	week := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC) // a Monday
+	submissions := []struct {
+		user, value int
+		at          time.Time
+	}{
+		{1, 10, week},
+		{2, 20, week.AddDate(0, 0, 6)},
+		{1, 30, week.AddDate(0, 0, 7)},
+		{3, 5, week.AddDate(0, 0, 8)},
+	}
+	for _, sub := range submissions {
+		if _, err := w.Submit("", sub.user, sub.value, KeepBest, sub.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Submit("", 4, 1, KeepBest, week); !errors.Is(err, ErrArchived) {
+		t.Fatalf("got error for archived period: %v, expected: %v", err, ErrArchived)
+	}
+	if err := w.At(week, 0).Add(Score{User: 4, Value: 1}); err == nil {
+		t.Fatalf("expected error for changing archived scores")
+	}
+	// periods without scores have the same tag every time, so clients polling them can skip the scores
+	tag, _ := w.At(week, -1).TopTag(10)
+	if calculated, _ := w.At(week, -2).TopTag(10); calculated != tag {
+		t.Fatalf("got tag %q of a period without scores, expected: %q", calculated, tag)
+	}
+	now := week.AddDate(0, 0, 9)
+	expected := [][]Score{{{1, 30}, {3, 5}}, {{2, 20}, {1, 10}}, nil}
+	for i := 0; i < 2; i++ {
+		for offset := range expected {
+			if calculated := w.At(now, -offset).Top(10); !reflect.DeepEqual(calculated, expected[offset]) {
+				t.Fatalf("got scores at offset %d: %v, expected: %v", -offset, calculated, expected[offset])
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if w, err = OpenWindowed(path, Weekly, time.UTC, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer w.Close()
+	if _, err := w.Submit("", 2, 40, KeepBest, now); err != nil {
+		t.Fatal(err)
+	}
+	if calculated, expected := w.At(now, 0).Top(10), []Score{{2, 40}, {1, 30}, {3, 5}}; !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got scores after reopening: %v, expected: %v", calculated, expected)
+	}
+}
+
+// TestWindowedRetention tests that only the latest archived periods are kept, and that the files of the others are deleted,
+// also when reopening the scores with a lower retention.
+func TestWindowedRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	w, err := OpenWindowed(path, Weekly, time.UTC, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	week := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC) // a Monday
+	for i := 0; i < 5; i++ {
+		if _, err := w.Submit("", 1, i+1, KeepBest, week.AddDate(0, 0, 7*i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := week.AddDate(0, 0, 7*4)
+	check := func(kept int) {
+		for offset := 0; offset < 5; offset++ {
+			var expected []Score
+			if offset <= kept {
+				expected = []Score{{1, 5 - offset}}
+			}
+			if calculated := w.At(now, -offset).Top(10); !reflect.DeepEqual(calculated, expected) {
+				t.Fatalf("got scores at offset %d: %v, expected: %v", -offset, calculated, expected)
+			}
+		}
+		paths, err := filepath.Glob(path + ".*" + LogExt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(paths) != kept+1 {
+			t.Fatalf("got files of the periods: %v, expected %d of them", paths, kept+1)
+		}
+	}
+	check(2)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w, err = OpenWindowed(path, Weekly, time.UTC, 1); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	check(1)
+}
+
+// TestWindowedErase tests that erasing a user removes it from all periods, and from the files of the archived ones.
+func TestWindowedErase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores")
+	w, err := OpenWindowed(path, Weekly, time.UTC, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	week := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC) // a Monday
+	for i := 0; i < 2; i++ {
+		for user := 1; user <= 2; user++ {
+			if _, err := w.Submit("", user, 10*user+i, KeepBest, week.AddDate(0, 0, 7*i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// reopened archived periods have their changes in their logs
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w, err = OpenWindowed(path, Weekly, time.UTC, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Erase(1); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path + "." + Weekly.key(Weekly.Start(week, time.UTC)) + LogExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(logHeaderSize) {
+		t.Fatalf("got log of %d bytes of the archived period, expected it empty", info.Size())
+	}
+	now := week.AddDate(0, 0, 7)
+	expected := [][]Score{{{2, 21}}, {{2, 20}}}
+	for i := 0; i < 2; i++ {
+		for offset := range expected {
+			if calculated := w.At(now, -offset).Top(10); !reflect.DeepEqual(calculated, expected[offset]) {
+				t.Fatalf("got scores at offset %d: %v, expected: %v", -offset, calculated, expected[offset])
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if w, err = OpenWindowed(path, Weekly, time.UTC, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer w.Close()
+}
+
+// TestWindowedRollover tests that submissions racing with the start of a new period either go to their period
+// or fail because it is archived, and that submissions fail once the scores are closed.
+func TestWindowedRollover(t *testing.T) {
+	w := NewWindowed(Daily, time.UTC, 100)
+	defer w.Close()
+	day := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	submitted := make([]int, 4)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_, err := w.Submit("", g+1, 1, Accumulate, day.AddDate(0, 0, i))
+				if err != nil && !errors.Is(err, ErrArchived) {
+					errs <- err
+					return
+				}
+				if err == nil {
+					submitted[g]++
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	kept := make([]int, 4)
+	for i := 0; i < 50; i++ {
+		for _, score := range w.At(day.AddDate(0, 0, i), 0).Top(4) {
+			kept[score.User-1] += score.Value
+		}
+	}
+	if !reflect.DeepEqual(kept, submitted) {
+		t.Fatalf("got scores kept in the periods: %v, expected the submitted ones: %v", kept, submitted)
+	}
+	w.Close()
+	if _, err := w.Submit("", 1, 1, Accumulate, day.AddDate(0, 0, 49)); !errors.Is(err, ErrClosed) {
+		t.Fatalf("got error submitting to closed scores: %v, expected: %v", err, ErrClosed)
+	}
+}
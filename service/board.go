@@ -0,0 +1,880 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gadumitrachioaiei/gamescore/scores"
+)
+
+// IdempotencyKeyHeader is the header with the idempotency key of a mutation.
+//
+// A mutation repeated with the same key, such as a retry after a timeout, is applied only once,
+// and the response has the result computed the first time.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Board serves the scores of a single leaderboard, under the /scores/ path.
+//
+// Besides the scores of all time, a board can keep the scores achieved in every day, week or month,
+// which are queried with the period and offset parameters.
+type Board struct {
+	scores  scores.Leaderboard
+	periods map[scores.Period]*scores.Windowed
+	shards  int              // number of shards of the scores of all time, if more than one
+	now     func() time.Time // current time, for the periods of the board
+}
+
+// Besides the methods of scores.Leaderboard, a board uses the methods below, if its scores have them.
+// The scores of package scores have all of them, but other implementations can lack some,
+// and then the requests which need them fail with 501 Not Implemented.
+type (
+	batcher interface {
+		ApplyBatch(mutations []scores.Mutation) ([]scores.VersionedScore, error)
+	}
+	loader interface {
+		Load(next func() (scores.Score, error)) error
+	}
+	historian interface {
+		History(user int, before int, limit int) ([]scores.HistoryEntry, error)
+	}
+	eraser interface {
+		Erase(user int) error
+	}
+	tagger interface {
+		TopTag(top int) (string, bool)
+	}
+	pager interface {
+		Page(cursor scores.Cursor, limit int) scores.Page
+	}
+	walker interface {
+		Walk(from int, fn func(scores.RankedScore) bool)
+	}
+	sweeper interface {
+		Sweep() int
+	}
+	checkpointer interface {
+		Checkpoint() error
+	}
+)
+
+func newBoard(s scores.Leaderboard) *Board {
+	return &Board{scores: s, periods: make(map[scores.Period]*scores.Windowed), now: time.Now}
+}
+
+// close closes the scores of the board.
+func (s *Board) close() error {
+	var err error
+	if closer, ok := s.scores.(io.Closer); ok {
+		err = closer.Close()
+	}
+	for _, w := range s.periods {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// sweep removes the expired scores of the board, returning their number.
+func (s *Board) sweep() int {
+	var n int
+	if sweeper, ok := s.scores.(sweeper); ok {
+		n = sweeper.Sweep()
+	}
+	for _, w := range s.periods {
+		n += w.Sweep()
+	}
+	return n
+}
+
+// checkpoint checkpoints the scores of the board.
+func (s *Board) checkpoint() error {
+	if checkpointer, ok := s.scores.(checkpointer); ok {
+		if err := checkpointer.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	for _, w := range s.periods {
+		if err := w.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Board) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, "/scores/submit") {
+		if req.Method != http.MethodPost && req.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.SubmitScore(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/import") {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.Import(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/batch") {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.ApplyBatch(w, req)
+		return
+	}
+	if req.Method == http.MethodPost {
+		s.AddScore(w, req)
+		return
+	}
+	if req.Method == http.MethodPut {
+		s.UpdateScore(w, req)
+		return
+	}
+	if req.Method == http.MethodDelete {
+		s.RemoveScore(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/top") {
+		s.Top(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/page") {
+		s.Page(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/range") {
+		s.Range(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/rank") {
+		s.Rank(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/around") {
+		s.Around(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/history") {
+		s.History(w, req)
+		return
+	}
+	if strings.HasPrefix(req.URL.Path, "/scores/export") {
+		s.Export(w, req)
+		return
+	}
+}
+
+// Score is a score of a user, with the reason it was achieved for, if any.
+//
+// Version is the version of the score after it was added or updated.
+type Score struct {
+	User    int
+	Total   int
+	Reason  string
+	Version uint64
+}
+
+// ScoreUpdate is a change of the score of a user, with the reason of the change, if any.
+//
+// If Version is not 0, or the request has an If-Match header with a version, the score is changed
+// only if it still has that version.
+type ScoreUpdate struct {
+	User    int
+	Score   int
+	Reason  string
+	Version uint64
+}
+
+// ScoreSubmission is a score achieved by a user, kept according to the policy:
+// "best" (the default), "latest" or "accumulate".
+type ScoreSubmission struct {
+	User   int
+	Value  int
+	Policy string
+	Reason string
+}
+
+// Submission is the result of a score submission.
+type Submission struct {
+	User         int
+	Total        int
+	Rank         int
+	PreviousRank int
+	RankChanged  bool
+	Created      bool
+	Version      uint64
+}
+
+// maxBatchSize is the maximum number of mutations in a batch.
+const maxBatchSize = 10000
+
+// BatchMutation is a mutation in a batch: Op is "add", to add Value as the score of a new user,
+// or "update", to add Value to the score of an existing user.
+//
+// Key is the idempotency key of the mutation, and Version is the version an updated score must have, if not 0.
+type BatchMutation struct {
+	Op      string
+	User    int
+	Value   int
+	Reason  string
+	Key     string
+	Version uint64
+}
+
+// BatchError is the error of a mutation in a batch, at Index in the batch.
+type BatchError struct {
+	Index int
+	Error string
+}
+
+// History is a page of the changes of the score of a user, from the latest to the earliest.
+//
+// Next is the cursor of the next page, empty if there are no earlier changes.
+type History struct {
+	User    int
+	Changes []scores.HistoryEntry
+	Next    string
+}
+
+// Page is a page of scores, from best to worst.
+//
+// Prev and Next are the cursors of the previous and next pages, empty if there are no better or worse scores.
+type Page struct {
+	Scores     []scores.RankedScore
+	Prev, Next string
+}
+
+// Rank is the position of a user among all players.
+type Rank struct {
+	User    int
+	Total   int
+	Rank    int
+	Players int
+	Version uint64
+}
+
+func (s *Board) AddScore(w http.ResponseWriter, req *http.Request) {
+	var score Score
+	if err := json.NewDecoder(req.Body).Decode(&score); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if score.User <= 0 {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+	key := req.Header.Get(IdempotencyKeyHeader)
+	added, err := s.scores.Apply(scores.Mutation{
+		Kind: scores.MutationAdd, User: score.User, Value: score.Total, Reason: score.Reason, Key: key,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if err := s.submitPeriods(key, score.User, score.Total, scores.Accumulate); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := Score{User: score.User, Total: added.Value, Reason: score.Reason, Version: added.Version}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Board) UpdateScore(w http.ResponseWriter, req *http.Request) {
+	var score ScoreUpdate
+	if err := json.NewDecoder(req.Body).Decode(&score); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if score.User <= 0 {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+	version, err := expectedVersion(req, score.Version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := req.Header.Get(IdempotencyKeyHeader)
+	newScore, err := s.scores.Apply(scores.Mutation{
+		Kind: scores.MutationUpdate, User: score.User, Value: score.Score, Reason: score.Reason, Key: key, Version: version,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if err := s.submitPeriods(key, score.User, score.Score, scores.Accumulate); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := Score{User: score.User, Total: newScore.Value, Reason: score.Reason, Version: newScore.Version}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Board) ApplyBatch(w http.ResponseWriter, req *http.Request) {
+	var batch []BatchMutation
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(batch) == 0 || len(batch) > maxBatchSize {
+		http.Error(w, "Invalid batch size", http.StatusBadRequest)
+		return
+	}
+	mutations := make([]scores.Mutation, len(batch))
+	var errs []BatchError
+	for i, m := range batch {
+		mutations[i] = scores.Mutation{User: m.User, Value: m.Value, Reason: m.Reason, Key: m.Key, Version: m.Version}
+		switch {
+		case m.User <= 0:
+			errs = append(errs, BatchError{Index: i, Error: "Invalid user id"})
+		case m.Op == "add":
+			mutations[i].Kind = scores.MutationAdd
+		case m.Op == "update":
+			mutations[i].Kind = scores.MutationUpdate
+		default:
+			errs = append(errs, BatchError{Index: i, Error: fmt.Sprintf("unknown operation: %q", m.Op)})
+		}
+	}
+	if len(errs) > 0 {
+		writeBatchErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+	batcher, ok := s.scores.(batcher)
+	if !ok {
+		http.Error(w, "Batches are not supported by the board", http.StatusNotImplemented)
+		return
+	}
+	results, err := batcher.ApplyBatch(mutations)
+	var batchErr *scores.BatchError
+	if errors.As(err, &batchErr) {
+		status := http.StatusBadRequest
+		for i, err := range batchErr.Errors {
+			if err != nil {
+				errs = append(errs, BatchError{Index: i, Error: err.Error()})
+				if errors.Is(err, scores.ErrVersionMismatch) {
+					status = http.StatusConflict
+				}
+			}
+		}
+		writeBatchErrors(w, status, errs)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if err := s.batchPeriods(mutations); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := make([]Score, len(results))
+	for i, result := range results {
+		response[i] = Score{User: result.User, Total: result.Value, Reason: batch[i].Reason, Version: result.Version}
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// writeBatchErrors responds with the errors of the mutations of a batch, none of which was applied.
+func writeBatchErrors(w http.ResponseWriter, status int, errs []BatchError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errs)
+}
+
+func (s *Board) Import(w http.ResponseWriter, req *http.Request) {
+	loader, ok := s.scores.(loader)
+	if !ok {
+		http.Error(w, "Importing is not supported by the board", http.StatusNotImplemented)
+		return
+	}
+	next, err := ScoreReader(req.Body, req.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := loader.Load(next); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Board) SubmitScore(w http.ResponseWriter, req *http.Request) {
+	var score ScoreSubmission
+	if err := json.NewDecoder(req.Body).Decode(&score); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if score.User <= 0 {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+	policy, err := scores.ParseSubmitPolicy(score.Policy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := req.Header.Get(IdempotencyKeyHeader)
+	sub, err := s.scores.SubmitIdempotent(key, score.User, score.Value, policy, score.Reason)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if err := s.submitPeriods(key, score.User, score.Value, policy); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := Submission{
+		User:         score.User,
+		Total:        sub.Value,
+		Rank:         sub.Rank,
+		PreviousRank: sub.PreviousRank,
+		RankChanged:  sub.RankChanged(),
+		Created:      sub.Created,
+		Version:      sub.Version,
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Board) RemoveScore(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := strconv.Atoi(req.Form.Get("user"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version, err := expectedVersion(req, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := req.Header.Get(IdempotencyKeyHeader)
+	erase := req.Form.Get("erase") == "true"
+	if erase {
+		// erasing does not depend on the current score, and it can be repeated
+		eraser, ok := s.scores.(eraser)
+		if !ok {
+			http.Error(w, "Erasing users is not supported by the board", http.StatusNotImplemented)
+			return
+		}
+		if version != 0 {
+			http.Error(w, "Erasing a user does not depend on its version", http.StatusBadRequest)
+			return
+		}
+		if err := eraser.Erase(user); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		key = ""
+	} else if _, err := s.scores.Apply(scores.Mutation{Kind: scores.MutationRemove, User: user, Key: key, Version: version}); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	now := s.now()
+	for _, period := range s.periods {
+		if erase {
+			if err := period.Erase(user); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			continue
+		}
+		if err := period.Remove(key, user, now); err != nil && !errors.Is(err, scores.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (s *Board) Top(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	top, err := strconv.Atoi(req.Form.Get("top"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := s.rankMode(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	periodScores, err := s.periodScores(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// the tag is read before the scores, so it is never newer than them
+	if tagger, ok := periodScores.(tagger); ok {
+		if tag, ok := tagger.TopTag(top); ok {
+			// the same top scores are sent differently for other rank modes and counts
+			etag := `"` + tag + "." + mode.String() + "." + strconv.Itoa(top) + `"`
+			w.Header().Set("ETag", etag)
+			if etagMatches(req.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+	topScores := periodScores.TopRanked(top, mode)
+	if err := json.NewEncoder(w).Encode(topScores); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Export streams all the scores in rank order, from the rank given by the from parameter, by default 1.
+//
+// Writers are not blocked while the scores are exported, so the scores which change meanwhile
+// can be exported at their old rank, their new one, both or neither.
+func (s *Board) Export(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from := 1
+	if req.Form.Get("from") != "" {
+		var err error
+		if from, err = strconv.Atoi(req.Form.Get("from")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	periodScores, err := s.periodScores(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	walker, ok := periodScores.(walker)
+	if !ok {
+		http.Error(w, "Exporting is not supported by the board", http.StatusNotImplemented)
+		return
+	}
+	format := req.Form.Get("format")
+	write, flush, err := ScoreWriter(w, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	walker.Walk(from, func(score scores.RankedScore) bool {
+		// an error means the client is gone, and the response cannot tell it anymore
+		return write(score) == nil
+	})
+	flush()
+}
+
+func (s *Board) Range(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	position, err := strconv.Atoi(req.Form.Get("position"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	count, err := strconv.Atoi(req.Form.Get("count"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := s.rankMode(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	periodScores, err := s.periodScores(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topScores := periodScores.RangeRanked(position, count, mode)
+	if err := json.NewEncoder(w).Encode(topScores); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Board) Rank(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := strconv.Atoi(req.Form.Get("user"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	periodScores, err := s.periodScores(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	score, version, err := periodScores.Lookup(user)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	result := Rank{User: user, Total: score.Value, Rank: score.Rank, Players: periodScores.Len(), Version: version}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Board) Around(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := strconv.Atoi(req.Form.Get("user"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	count, err := strconv.Atoi(req.Form.Get("count"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	periodScores, err := s.periodScores(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	aroundScores, err := periodScores.AroundUser(user, count)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	if err := json.NewEncoder(w).Encode(aroundScores); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Board) History(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := strconv.Atoi(req.Form.Get("user"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if req.Form.Get("limit") != "" {
+		if limit, err = strconv.Atoi(req.Form.Get("limit")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if limit <= 0 || limit > 1000 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	var before int
+	if req.Form.Get("cursor") != "" {
+		if before, err = strconv.Atoi(req.Form.Get("cursor")); err != nil || before <= 0 {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	historian, ok := s.scores.(historian)
+	if !ok {
+		http.Error(w, "History is not supported by the board", http.StatusNotImplemented)
+		return
+	}
+	// one more change is asked for, to know if there are earlier ones, since the earliest changes may have been dropped
+	changes, err := historian.History(user, before, limit+1)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	result := History{User: user, Changes: changes}
+	if len(changes) > limit {
+		result.Changes = changes[:limit]
+		result.Next = strconv.Itoa(changes[limit-1].Seq)
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Page returns a page of scores, next to the cursor parameter, or starting with the best score if it is missing.
+//
+// The cursors stay next to the same scores when other scores change, so paging does not skip or repeat scores.
+func (s *Board) Page(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if req.Form.Get("limit") != "" {
+		var err error
+		if limit, err = strconv.Atoi(req.Form.Get("limit")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if limit <= 0 || limit > 1000 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	cursor, err := scores.ParseCursor(req.Form.Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	periodScores, err := s.periodScores(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pager, ok := periodScores.(pager)
+	if !ok {
+		http.Error(w, "Pages are not supported by the board", http.StatusNotImplemented)
+		return
+	}
+	page := pager.Page(cursor, limit)
+	result := Page{Scores: page.Scores, Prev: page.Prev.String(), Next: page.Next.String()}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// etagMatches returns whether the value of an If-None-Match header matches the etag.
+func etagMatches(header string, etag string) bool {
+	for _, match := range strings.Split(header, ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == "*" || match == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion returns the version from the If-Match header of the request, or version if the header is missing.
+func expectedVersion(req *http.Request, version uint64) (uint64, error) {
+	match := req.Header.Get("If-Match")
+	if match == "" {
+		return version, nil
+	}
+	version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(match, "W/"), `"`), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid If-Match header: %q", match)
+	}
+	return version, nil
+}
+
+// rankMode returns the rank mode from the mode parameter of the request,
+// or the rank mode of the board if the parameter is missing.
+//
+// The scores of all time of a board with several shards do not have dense ranks, which would hold every shard
+// while counting the distinct scores one by one.
+func (s *Board) rankMode(req *http.Request) (scores.RankMode, error) {
+	if req.Form.Get("mode") == "" {
+		return s.scores.RankMode(), nil
+	}
+	mode, err := scores.ParseRankMode(req.Form.Get("mode"))
+	if err != nil {
+		return 0, err
+	}
+	if period, _ := scores.ParsePeriod(req.Form.Get("period")); mode == scores.DenseRank && s.shards > 1 && period == scores.AllTime {
+		return 0, errors.New("boards with several shards do not have dense ranks")
+	}
+	return mode, nil
+}
+
+// periodScores returns the scores of the period from the period parameter of the request,
+// shifted by the offset parameter, so an offset of -1 is the previous period.
+//
+// If the period parameter is missing it returns the scores of all time.
+func (s *Board) periodScores(req *http.Request) (scores.Leaderboard, error) {
+	period, err := scores.ParsePeriod(req.Form.Get("period"))
+	if err != nil {
+		return nil, err
+	}
+	var offset int
+	if req.Form.Get("offset") != "" {
+		if offset, err = strconv.Atoi(req.Form.Get("offset")); err != nil {
+			return nil, err
+		}
+	}
+	if offset > 0 {
+		return nil, fmt.Errorf("invalid offset: %d", offset)
+	}
+	if period == scores.AllTime {
+		if offset != 0 {
+			return nil, errors.New("all time scores do not have an offset")
+		}
+		return s.scores, nil
+	}
+	w, ok := s.periods[period]
+	if !ok {
+		return nil, fmt.Errorf("board does not have %s scores", period)
+	}
+	return w.At(s.now(), offset), nil
+}
+
+// batchPeriods submits the scores of the mutations of a batch to the current period of every period of the board,
+// each period getting all of them at once.
+//
+// The periods are changed after the scores of all time, so if this fails, the batch is applied only to some of them.
+// Applying the batch again with the same idempotency keys then applies it to the others.
+func (s *Board) batchPeriods(mutations []scores.Mutation) error {
+	now := s.now()
+	for period, w := range s.periods {
+		if _, err := w.SubmitBatch(mutations, now); err != nil {
+			return fmt.Errorf("batch applied to the scores of all time, but not to the %s scores: %w", period, err)
+		}
+	}
+	return nil
+}
+
+// submitPeriods submits the score of the user to the current period of every period of the board.
+func (s *Board) submitPeriods(key string, user int, value int, policy scores.SubmitPolicy) error {
+	now := s.now()
+	for _, period := range s.periods {
+		if _, err := period.Submit(key, user, value, policy, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
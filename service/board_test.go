@@ -0,0 +1,256 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gadumitrachioaiei/gamescore/scores"
+)
+
+// TestBoardUpdates tests submissions, idempotency keys and batches, and that they also go to the periods of the board.
+func TestBoardUpdates(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	key := http.Header{IdempotencyKeyHeader: {"7b1f0c"}}
+	serveRequests(t, svc, []request{
+		{"POST", "/boards/", `{"name": "cup", "periods": ["daily", "weekly"]}`, nil, 201, ""},
+		{"POST", "/boards/cup/scores/submit/", `{"user": 1, "value": 10}`, nil, 200,
+			`{"User":1,"Total":10,"Rank":1,"PreviousRank":0,"RankChanged":true,"Created":true,"Version":1}`},
+		{"POST", "/boards/cup/scores/submit/", `{"user": 1, "value": 5}`, nil, 200,
+			`{"User":1,"Total":10,"Rank":1,"PreviousRank":1,"RankChanged":false,"Created":false,"Version":1}`},
+		{"PUT", "/boards/cup/scores/submit/", `{"user": 1, "value": 5, "policy": "accumulate"}`, nil, 200,
+			`{"User":1,"Total":15,"Rank":1,"PreviousRank":1,"RankChanged":false,"Created":false,"Version":2}`},
+		// a repeated key is applied once, and returns the first result
+		{"PUT", "/boards/cup/scores/", `{"user": 1, "score": 5}`, key, 200, `{"User":1,"Total":20,"Reason":"","Version":3}`},
+		{"PUT", "/boards/cup/scores/", `{"user": 1, "score": 5}`, key, 200, `{"User":1,"Total":20,"Reason":"","Version":3}`},
+		{"POST", "/boards/cup/scores/batch/", `[{"op": "add", "user": 2, "value": 30}, {"op": "update", "user": 1, "value": 1, "reason": "match"}]`,
+			nil, 200, `[{"User":2,"Total":30,"Reason":"","Version":4},{"User":1,"Total":21,"Reason":"match","Version":5}]`},
+		// a batch is applied together or not at all
+		{"POST", "/boards/cup/scores/batch/", `[{"op": "add", "user": 3, "value": 1}, {"op": "update", "user": 4, "value": 1}]`,
+			nil, 400, `[{"Index":1,"Error":"user cannot be found: 4"}]`},
+		{"POST", "/boards/cup/scores/batch/", `[{"op": "update", "user": 1, "value": 1, "version": 1}]`,
+			nil, 409, `[{"Index":0,"Error":"version mismatch: user 1 has version 5, not 1"}]`},
+		{"GET", "/boards/cup/scores/rank/?user=3", "", nil, 404, "user cannot be found: 3"},
+		{"GET", "/boards/cup/scores/top/?top=10", "", nil, 200, `[{"User":2,"Value":30,"Rank":1},{"User":1,"Value":21,"Rank":2}]`},
+		{"GET", "/boards/cup/scores/top/?top=10&period=daily", "", nil, 200, `[{"User":2,"Value":30,"Rank":1},{"User":1,"Value":21,"Rank":2}]`},
+		{"GET", "/boards/cup/scores/top/?top=10&period=weekly", "", nil, 200, `[{"User":2,"Value":30,"Rank":1},{"User":1,"Value":21,"Rank":2}]`},
+		{"GET", "/boards/cup/scores/top/?top=10&period=weekly&offset=-1", "", nil, 200, "null"},
+		{"GET", "/boards/cup/scores/top/?top=10&period=weekly&offset=1", "", nil, 400, "invalid offset: 1"},
+		{"GET", "/boards/cup/scores/top/?top=10&period=monthly", "", nil, 400, "board does not have monthly scores"},
+		{"DELETE", "/boards/cup/scores/?user=2", "", nil, 200, ""},
+		{"GET", "/boards/cup/scores/top/?top=10&period=daily", "", nil, 200, `[{"User":1,"Value":21,"Rank":1}]`},
+		{"DELETE", "/boards/cup/scores/?user=1&erase=true", "", nil, 200, ""},
+		{"GET", "/boards/cup/scores/top/?top=10&period=weekly", "", nil, 200, "null"},
+	})
+}
+
+// TestBoardRankModes tests the rank modes of a board and of requests.
+func TestBoardRankModes(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	requests := []request{
+		{"POST", "/boards/", `{"name": "dense", "rankMode": "dense", "tieBreak": "first"}`, nil, 201, ""},
+		{"POST", "/boards/", `{"name": "sparse", "rankMode": "best"}`, nil, 400, `unknown rank mode: "best"`},
+	}
+	for user, value := range []int{20, 10, 10, 5} {
+		requests = append(requests, request{"POST", "/boards/dense/scores/", fmt.Sprintf(`{"user": %d, "total": %d}`, user+1, value), nil, 200, "*"})
+	}
+	requests = append(requests, []request{
+		{"GET", "/boards/dense/scores/top/?top=10", "", nil, 200,
+			`[{"User":1,"Value":20,"Rank":1},{"User":2,"Value":10,"Rank":2},{"User":3,"Value":10,"Rank":2},{"User":4,"Value":5,"Rank":3}]`},
+		{"GET", "/boards/dense/scores/top/?top=10&mode=competition", "", nil, 200,
+			`[{"User":1,"Value":20,"Rank":1},{"User":2,"Value":10,"Rank":2},{"User":3,"Value":10,"Rank":2},{"User":4,"Value":5,"Rank":4}]`},
+		{"GET", "/boards/dense/scores/range/?position=3&count=1&mode=ordinal", "", nil, 200,
+			`[{"User":2,"Value":10,"Rank":2},{"User":3,"Value":10,"Rank":3},{"User":4,"Value":5,"Rank":4}]`},
+		{"GET", "/boards/dense/scores/rank/?user=4", "", nil, 200, `{"User":4,"Total":5,"Rank":3,"Players":4,"Version":4}`},
+	}...)
+	serveRequests(t, svc, requests)
+}
+
+// TestBoardTopETag tests that the top scores are not sent again until they change.
+func TestBoardTopETag(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	serveRequests(t, svc, []request{{"POST", "/scores/", `{"user": 1, "total": 10}`, nil, 200, "*"}})
+	top := request{"GET", "/scores/top/?top=10", "", nil, 200, `[{"User":1,"Value":10,"Rank":1}]`}
+	w := serveRequest(svc, top)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got response %d with etag %q, expected: %d with an etag", w.Code, etag, http.StatusOK)
+	}
+	top.header = http.Header{"If-None-Match": {etag}}
+	top.status, top.expected = http.StatusNotModified, ""
+	serveRequests(t, svc, []request{
+		top,
+		{"GET", "/scores/top/?top=10", "", http.Header{"If-None-Match": {`"other", ` + etag}}, 304, ""},
+		{"GET", "/scores/top/?top=10", "", http.Header{"If-None-Match": {"W/" + etag}}, 304, ""},
+		{"GET", "/scores/top/?top=10", "", http.Header{"If-None-Match": {`"other"`}}, 200, `[{"User":1,"Value":10,"Rank":1}]`},
+		// other rank modes and counts are other representations of the same top scores
+		{"GET", "/scores/top/?top=10&mode=competition", "", http.Header{"If-None-Match": {etag}}, 200, `[{"User":1,"Value":10,"Rank":1}]`},
+		{"GET", "/scores/top/?top=5", "", http.Header{"If-None-Match": {etag}}, 200, `[{"User":1,"Value":10,"Rank":1}]`},
+		{"POST", "/scores/", `{"user": 2, "total": 5}`, nil, 200, "*"},
+		{"PUT", "/scores/", `{"user": 1, "score": 1}`, nil, 200, "*"},
+	})
+	top.status, top.expected = http.StatusOK, `[{"User":1,"Value":11,"Rank":1},{"User":2,"Value":5,"Rank":2}]`
+	serveRequests(t, svc, []request{top})
+	if calculated := serveRequest(svc, top).Header().Get("ETag"); calculated == etag {
+		t.Fatalf("got the same etag %q after the top changed", etag)
+	}
+}
+
+// TestBoardHistory tests paging through the history of a user with cursors, and erasing it.
+func TestBoardHistory(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	serveRequests(t, svc, []request{{"POST", "/scores/", `{"user": 1, "total": 1, "reason": "level 1"}`, nil, 200, "*"}})
+	for i := 0; i < 4; i++ {
+		serveRequests(t, svc, []request{{"PUT", "/scores/", `{"user": 1, "score": 1}`, nil, 200, "*"}})
+	}
+	var totals []int
+	for cursor, pages := "", 0; ; pages++ {
+		w := serveRequest(svc, request{method: "GET", url: "/scores/history/?user=1&limit=2&cursor=" + cursor})
+		if w.Code != http.StatusOK || pages > 3 {
+			t.Fatalf("got response %d %q for page %d", w.Code, w.Body.String(), pages)
+		}
+		var history History
+		decode(t, w, &history)
+		for _, change := range history.Changes {
+			totals = append(totals, change.Total)
+		}
+		if history.Next == "" {
+			break
+		}
+		cursor = history.Next
+	}
+	if expected := []int{5, 4, 3, 2, 1}; !reflect.DeepEqual(totals, expected) {
+		t.Fatalf("got totals in the history: %v, expected: %v", totals, expected)
+	}
+	serveRequests(t, svc, []request{
+		{"GET", "/scores/history/?user=1&limit=1", "", nil, 200, `{"User":1,"Changes":[{"Seq":5,"Delta":1,"Total":5,"Time":*`},
+		{"GET", "/scores/history/?user=1&limit=0", "", nil, 400, "Invalid limit"},
+		{"GET", "/scores/history/?user=1&cursor=x", "", nil, 400, "Invalid cursor"},
+		{"GET", "/scores/history/?user=2", "", nil, 404, "user cannot be found: 2"},
+		{"DELETE", "/scores/?user=1&erase=true", "", ifMatch(`"5"`), 400, "Erasing a user does not depend on its version"},
+		{"DELETE", "/scores/?user=1&erase=true", "", nil, 200, ""},
+		{"DELETE", "/scores/?user=1&erase=true", "", nil, 200, ""},
+		{"GET", "/scores/history/?user=1", "", nil, 404, "user cannot be found: 1"},
+		{"GET", "/scores/rank/?user=1", "", nil, 404, "user cannot be found: 1"},
+	})
+}
+
+// TestBoardHistoryLimit tests that paging through a capped history stops at the earliest kept change.
+func TestBoardHistoryLimit(t *testing.T) {
+	svc := New(scores.New(scores.WithHistory(), scores.WithHistoryLimit(4)))
+	defer svc.Close()
+	serveRequests(t, svc, []request{{"POST", "/scores/", `{"user": 1, "total": 1}`, nil, 200, "*"}})
+	for i := 0; i < 5; i++ {
+		serveRequests(t, svc, []request{{"PUT", "/scores/", `{"user": 1, "score": 1}`, nil, 200, "*"}})
+	}
+	var seqs []int
+	for cursor, pages := "", 0; ; pages++ {
+		w := serveRequest(svc, request{method: "GET", url: "/scores/history/?user=1&limit=2&cursor=" + cursor})
+		if w.Code != http.StatusOK || pages > 1 {
+			t.Fatalf("got response %d %q for page %d", w.Code, w.Body.String(), pages)
+		}
+		var history History
+		decode(t, w, &history)
+		for _, change := range history.Changes {
+			seqs = append(seqs, change.Seq)
+		}
+		if history.Next == "" {
+			break
+		}
+		cursor = history.Next
+	}
+	if expected := []int{6, 5, 4, 3}; !reflect.DeepEqual(seqs, expected) {
+		t.Fatalf("got changes in the history: %v, expected: %v", seqs, expected)
+	}
+}
+
+// TestBoardPage tests that following the cursors of pages returns every score once, in both directions.
+func TestBoardPage(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	for user := 1; user <= 5; user++ {
+		serveRequests(t, svc, []request{{"POST", "/scores/", fmt.Sprintf(`{"user": %d, "total": %d}`, user, 10*user), nil, 200, "*"}})
+	}
+	page := func(cursor string) Page {
+		w := serveRequest(svc, request{method: "GET", url: "/scores/page/?limit=2&cursor=" + cursor})
+		if w.Code != http.StatusOK {
+			t.Fatalf("got response %d %q for cursor %q", w.Code, w.Body.String(), cursor)
+		}
+		var p Page
+		decode(t, w, &p)
+		return p
+	}
+	users := func(p Page) []int {
+		var users []int
+		for _, score := range p.Scores {
+			users = append(users, score.User)
+		}
+		return users
+	}
+	first := page("")
+	if calculated, expected := users(first), []int{5, 4}; !reflect.DeepEqual(calculated, expected) || first.Prev != "" {
+		t.Fatalf("got first page: %v with previous cursor %q, expected: %v without one", calculated, first.Prev, expected)
+	}
+	// a score changing before the cursor does not move the next page
+	serveRequests(t, svc, []request{{"PUT", "/scores/", `{"user": 1, "score": 45}`, nil, 200, "*"}})
+	second := page(first.Next)
+	if calculated, expected := users(second), []int{3, 2}; !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got second page: %v, expected: %v", calculated, expected)
+	}
+	if second.Next != "" {
+		t.Fatalf("got next cursor %q of the last page, expected none", second.Next)
+	}
+	if calculated, expected := users(page(second.Prev)), []int{5, 4}; !reflect.DeepEqual(calculated, expected) {
+		t.Fatalf("got page before the second one: %v, expected: %v", calculated, expected)
+	}
+	serveRequests(t, svc, []request{
+		{"GET", "/scores/page/?cursor=%21", "", nil, 400, "*"},
+		{"GET", "/scores/page/?limit=1001", "", nil, 400, "Invalid limit"},
+	})
+}
+
+// TestBoardImportExport tests that exported scores can be imported into another board.
+func TestBoardImportExport(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	serveRequests(t, svc, []request{
+		{"POST", "/scores/import/?format=csv", "1,30\n2,20\n3,10\n", nil, 201, ""},
+		{"POST", "/scores/import/?format=csv", "4,5\n", nil, 400, "*"},
+		{"POST", "/boards/", `{"name": "copy"}`, nil, 201, ""},
+		{"POST", "/boards/copy/scores/import/?format=csv", "1,10\n2,20\n", nil, 400, "*"},
+		{"POST", "/boards/copy/scores/import/?format=xml", "", nil, 400, "*"},
+		{"GET", "/scores/import/?format=csv", "", nil, 405, "Method not allowed"},
+		{"GET", "/scores/export/?format=csv", "", nil, 200, "rank,user,value\n1,1,30\n2,2,20\n3,3,10"},
+		{"GET", "/scores/export/?format=csv&from=2", "", nil, 200, "rank,user,value\n2,2,20\n3,3,10"},
+		{"GET", "/scores/export/?format=xml", "", nil, 400, "*"},
+	})
+	w := serveRequest(svc, request{method: "GET", url: "/scores/export/?format=ndjson"})
+	serveRequests(t, svc, []request{
+		{"POST", "/boards/copy/scores/import/?format=ndjson", w.Body.String(), nil, 201, ""},
+		{"GET", "/boards/copy/scores/top/?top=10", "", nil, 200,
+			`[{"User":1,"Value":30,"Rank":1},{"User":2,"Value":20,"Rank":2},{"User":3,"Value":10,"Rank":3}]`},
+	})
+}
+
+// TestBoardSharded tests that a sharded board serves the requests of the scores of package scores, except batches.
+func TestBoardSharded(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	serveRequests(t, svc, []request{
+		{"POST", "/boards/", `{"name": "global", "shards": 4}`, nil, 201, ""},
+		{"POST", "/boards/global/scores/", `{"user": 1, "total": 10}`, nil, 200, "*"},
+		{"POST", "/boards/global/scores/", `{"user": 2, "total": 20}`, nil, 200, "*"},
+		{"GET", "/boards/global/scores/top/?top=10", "", nil, 200, `[{"User":2,"Value":20,"Rank":1},{"User":1,"Value":10,"Rank":2}]`},
+		{"GET", "/boards/global/scores/history/?user=1", "", nil, 200, "*"},
+		{"POST", "/boards/global/scores/batch/", `[{"op": "add", "user": 3, "value": 1}]`, nil, 400, "sharded scores do not support batches"},
+		{"GET", "/boards/global/scores/top/?top=10&mode=dense", "", nil, 400, "boards with several shards do not have dense ranks"},
+		{"GET", "/boards/global/scores/top/?top=10&mode=competition", "", nil, 200, `[{"User":2,"Value":20,"Rank":1},{"User":1,"Value":10,"Rank":2}]`},
+		{"POST", "/boards/", `{"name": "dense", "shards": 4, "rankMode": "dense"}`, nil, 400, "boards with several shards do not have dense ranks"},
+		{"POST", "/boards/", `{"name": "dense", "shards": 1, "rankMode": "dense"}`, nil, 201, ""},
+	})
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gadumitrachioaiei/gamescore/scores"
+)
+
+// ScoreWriter returns a function which writes ranked scores to w, one by one, and a function which flushes them.
+//
+// The format is "csv", with the columns rank, user and value after a header, or "ndjson", with an object
+// such as {"User": 1, "Value": 10, "Rank": 1} on every line, so both can be read back by ScoreReader.
+func ScoreWriter(w io.Writer, format string) (func(scores.RankedScore) error, func() error, error) {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case "csv":
+		if _, err := bw.WriteString("rank,user,value\n"); err != nil {
+			return nil, nil, err
+		}
+		write := func(score scores.RankedScore) error {
+			line := strconv.AppendInt(nil, int64(score.Rank), 10)
+			line = append(line, ',')
+			line = strconv.AppendInt(line, int64(score.User), 10)
+			line = append(line, ',')
+			line = strconv.AppendInt(line, int64(score.Value), 10)
+			line = append(line, '\n')
+			_, err := bw.Write(line)
+			return err
+		}
+		return write, bw.Flush, nil
+	case "ndjson":
+		encoder := json.NewEncoder(bw)
+		return func(score scores.RankedScore) error { return encoder.Encode(score) }, bw.Flush, nil
+	}
+	return nil, nil, fmt.Errorf("unknown format: %q", format)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gadumitrachioaiei/gamescore/scores"
+)
+
+// ScoreReader returns a function which reads scores from r, one by one, as needed by scores.Load.
+//
+// The format is "csv", with the columns user and value, or "ndjson", with an object
+// such as {"User": 1, "Value": 10} on every line. A csv header with the names of the columns is optional.
+func ScoreReader(r io.Reader, format string) (func() (scores.Score, error), error) {
+	switch format {
+	case "csv":
+		return csvScores(r), nil
+	case "ndjson":
+		return ndjsonScores(r), nil
+	}
+	return nil, fmt.Errorf("unknown format: %q", format)
+}
+
+func csvScores(r io.Reader) func() (scores.Score, error) {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.ReuseRecord = true
+	userColumn, valueColumn := 0, 1
+	var line int
+	return func() (scores.Score, error) {
+		for {
+			record, err := cr.Read()
+			if err != nil {
+				return scores.Score{}, err
+			}
+			line++
+			if line == 1 && len(record) > 1 {
+				if _, err := strconv.Atoi(strings.TrimSpace(record[0])); err != nil {
+					// a header, which can have other columns as well
+					userColumn, valueColumn = -1, -1
+					for i, name := range record {
+						switch strings.ToLower(strings.TrimSpace(name)) {
+						case "user":
+							userColumn = i
+						case "value", "score", "total":
+							valueColumn = i
+						}
+					}
+					if userColumn < 0 || valueColumn < 0 {
+						return scores.Score{}, fmt.Errorf("csv header without user and value columns: %v", record)
+					}
+					continue
+				}
+			}
+			if userColumn >= len(record) || valueColumn >= len(record) {
+				return scores.Score{}, fmt.Errorf("line %d: missing columns", line)
+			}
+			user, err := strconv.Atoi(strings.TrimSpace(record[userColumn]))
+			if err != nil {
+				return scores.Score{}, fmt.Errorf("line %d: %w", line, err)
+			}
+			value, err := strconv.Atoi(strings.TrimSpace(record[valueColumn]))
+			if err != nil {
+				return scores.Score{}, fmt.Errorf("line %d: %w", line, err)
+			}
+			return scores.Score{User: user, Value: value}, nil
+		}
+	}
+}
+
+func ndjsonScores(r io.Reader) func() (scores.Score, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	var line int
+	return func() (scores.Score, error) {
+		var score scores.Score
+		if err := decoder.Decode(&score); err != nil {
+			if err == io.EOF {
+				return score, err
+			}
+			return score, fmt.Errorf("line %d: %w", line+1, err)
+		}
+		line++
+		return score, nil
+	}
+}
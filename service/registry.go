@@ -0,0 +1,425 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gadumitrachioaiei/gamescore/scores"
+)
+
+// DefaultBoard is the name of the board that always exists, and is served under /scores/.
+const DefaultBoard = "default"
+
+var (
+	// ErrBoardNotFound is returned when there is no board with the given name.
+	ErrBoardNotFound = errors.New("board cannot be found")
+	// ErrBoardExists is returned when creating a board with the name of an existing one.
+	ErrBoardExists = errors.New("existing board")
+)
+
+// boardName is what a board name looks like, so we can use it in urls.
+var boardName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// dedupSize is how many idempotency keys every board remembers.
+const dedupSize = 10000
+
+// configExt is the extension of the file where the config of a persisted board is stored.
+const configExt = ".json"
+
+// BoardConfig describes a board.
+type BoardConfig struct {
+	Name string
+	// Order is "desc" (the default) if higher scores are better, or "asc" if lower scores are better.
+	Order string
+	// TieBreak is how users with equal scores are ranked: "last" (the default), "first", "user" or "shared".
+	TieBreak string
+	// RankMode is how ranks are calculated for equal scores, when a request does not choose one:
+	// "ordinal" (the default), "competition" or "dense".
+	RankMode string
+	// Periods are the periods for which the board keeps separate scores, besides all time:
+	// "daily", "weekly" or "monthly".
+	Periods []string
+	// Timezone is the IANA name of the timezone where the periods start, by default UTC.
+	Timezone string
+	// Retention is how many previous periods of every kind are kept, by default 30.
+	// The scores of older periods are deleted.
+	Retention int
+	// Expiry is how long the score of a user is kept after it was achieved, such as "24h".
+	// By default scores never expire.
+	Expiry string
+	// Shards is how many independent trees keep the scores of all time, partitioning the users,
+	// so changes of users in different shards do not wait for each other. By default there is a single tree.
+	// It cannot be changed after the board is created, and boards with several shards do not have dense ranks.
+	Shards int
+}
+
+// maxShards is the maximum number of shards of a board.
+const maxShards = 256
+
+// defaultRetention is how many previous periods of every kind a board keeps, if its config does not say.
+const defaultRetention = 30
+
+// options returns the options for the scores of the board.
+func (c BoardConfig) options() ([]scores.Option, error) {
+	order, err := scores.ParseOrder(c.Order)
+	if err != nil {
+		return nil, err
+	}
+	tieBreak, err := scores.ParseTieBreak(c.TieBreak)
+	if err != nil {
+		return nil, err
+	}
+	rankMode, err := scores.ParseRankMode(c.RankMode)
+	if err != nil {
+		return nil, err
+	}
+	options := []scores.Option{
+		scores.WithOrder(order), scores.WithTieBreak(tieBreak), scores.WithRankMode(rankMode), scores.WithDedup(dedupSize),
+	}
+	if c.Expiry != "" {
+		ttl, err := time.ParseDuration(c.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("invalid expiry: %s", c.Expiry)
+		}
+		options = append(options, scores.WithExpiry(ttl))
+	}
+	return options, nil
+}
+
+// periods returns the periods of the board and the location where they start.
+func (c BoardConfig) periods() ([]scores.Period, *time.Location, error) {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	var periods []scores.Period
+	for _, name := range c.Periods {
+		period, err := scores.ParsePeriod(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if period == scores.AllTime {
+			return nil, nil, errors.New("all time scores are always kept")
+		}
+		periods = append(periods, period)
+	}
+	if c.Retention < 0 {
+		return nil, nil, fmt.Errorf("invalid retention: %d", c.Retention)
+	}
+	return periods, loc, nil
+}
+
+// retention returns how many previous periods of every kind the board keeps.
+func (c BoardConfig) retention() int {
+	if c.Retention == 0 {
+		return defaultRetention
+	}
+	return c.Retention
+}
+
+// Registry keeps our named boards, each of them with its own independent scores.
+//
+// Thread safe.
+type Registry struct {
+	mu     sync.Mutex
+	boards map[string]*Board
+	dir    string           // if not empty, the scores of every board are persisted in this directory
+	now    func() time.Time // current time, for the periods of the boards
+}
+
+// NewRegistry returns a registry that has only the default board, with the given scores, and keeps it in memory.
+//
+// If scores is nil, the default board keeps its scores in memory, in a scores.Scores with history and idempotency keys.
+func NewRegistry(s scores.Leaderboard) *Registry {
+	if s == nil {
+		s = scores.New(scores.WithHistory(), scores.WithDedup(dedupSize))
+	}
+	return &Registry{boards: map[string]*Board{DefaultBoard: newBoard(s)}, now: time.Now}
+}
+
+// OpenRegistry returns a registry with the boards persisted in the directory dir,
+// creating the default board if it does not exist.
+func OpenRegistry(dir string) (*Registry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+scores.LogExt))
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{boards: make(map[string]*Board), dir: dir, now: time.Now}
+	for _, path := range paths {
+		config := BoardConfig{Name: strings.TrimSuffix(filepath.Base(path), scores.LogExt)}
+		if !boardName.MatchString(config.Name) {
+			// the scores of a period of a board
+			continue
+		}
+		data, err := os.ReadFile(r.path(config.Name) + configExt)
+		if err != nil && !os.IsNotExist(err) {
+			r.Close()
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &config); err != nil {
+				r.Close()
+				return nil, fmt.Errorf("config of board %s: %w", config.Name, err)
+			}
+		}
+		if err := r.open(config); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	if _, ok := r.boards[DefaultBoard]; !ok {
+		if _, err := r.Create(BoardConfig{Name: DefaultBoard}); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Close closes all boards.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for _, board := range r.boards {
+		if closeErr := board.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Create creates a new empty board.
+func (r *Registry) Create(config BoardConfig) (*Board, error) {
+	if !boardName.MatchString(config.Name) {
+		return nil, fmt.Errorf("invalid board name: %q", config.Name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.boards[config.Name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrBoardExists, config.Name)
+	}
+	if _, err := config.options(); err != nil {
+		return nil, err
+	}
+	if _, _, err := config.periods(); err != nil {
+		return nil, err
+	}
+	if config.Shards < 0 || config.Shards > maxShards {
+		return nil, fmt.Errorf("invalid number of shards: %d", config.Shards)
+	}
+	if config.Shards > 1 && config.RankMode == scores.DenseRank.String() {
+		return nil, errors.New("boards with several shards do not have dense ranks")
+	}
+	if r.dir != "" {
+		// a snapshot without a log is left by a crash while deleting a board with the same name
+		if err := os.Remove(r.path(config.Name) + scores.SnapshotExt); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err := r.removePeriods(config.Name); err != nil {
+			return nil, err
+		}
+		// the config is written before the log, and boards without a log are ignored
+		data, err := json.Marshal(config)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(r.path(config.Name)+configExt, data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.open(config); err != nil {
+		return nil, err
+	}
+	return r.boards[config.Name], nil
+}
+
+// open adds the board to the registry, restoring its scores if the registry is persisted.
+func (r *Registry) open(config BoardConfig) error {
+	options, err := config.options()
+	if err != nil {
+		return fmt.Errorf("config of board %s: %w", config.Name, err)
+	}
+	periods, loc, err := config.periods()
+	if err != nil {
+		return fmt.Errorf("config of board %s: %w", config.Name, err)
+	}
+	// only the scores of all time keep the history of the users
+	allTime := append([]scores.Option{scores.WithHistory()}, options...)
+	var s scores.Leaderboard
+	switch {
+	case config.Shards > 1 && r.dir != "":
+		s, err = scores.OpenSharded(r.path(config.Name), config.Shards, allTime...)
+	case config.Shards > 1:
+		s = scores.NewSharded(config.Shards, allTime...)
+	case r.dir != "":
+		s, err = scores.Open(r.path(config.Name), allTime...)
+	default:
+		s = scores.New(allTime...)
+	}
+	if err != nil {
+		return err
+	}
+	board := newBoard(s)
+	board.shards = config.Shards
+	// the clock of the registry is read on every use, so it can be replaced after the boards are opened
+	board.now = func() time.Time { return r.now() }
+	for _, period := range periods {
+		w := scores.NewWindowed(period, loc, config.retention(), options...)
+		if r.dir != "" {
+			if w, err = scores.OpenWindowed(r.path(config.Name), period, loc, config.retention(), options...); err != nil {
+				board.close()
+				return err
+			}
+		}
+		board.periods[period] = w
+	}
+	r.boards[config.Name] = board
+	return nil
+}
+
+// Load loads the scores returned by next, sorted from best to worst, into the empty board with the given name,
+// as by scores.Load.
+func (r *Registry) Load(name string, next func() (scores.Score, error)) error {
+	board, err := r.Get(name)
+	if err != nil {
+		return err
+	}
+	loader, ok := board.scores.(loader)
+	if !ok {
+		return fmt.Errorf("board %s does not support loading scores", name)
+	}
+	return loader.Load(next)
+}
+
+// Get returns the board with the given name.
+func (r *Registry) Get(name string) (*Board, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	board, ok := r.boards[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBoardNotFound, name)
+	}
+	return board, nil
+}
+
+// Delete deletes the board with the given name, together with its scores.
+//
+// The default board cannot be deleted.
+func (r *Registry) Delete(name string) error {
+	if name == DefaultBoard {
+		return fmt.Errorf("cannot delete the default board")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	board, ok := r.boards[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrBoardNotFound, name)
+	}
+	delete(r.boards, name)
+	if r.dir == "" {
+		return nil
+	}
+	if err := board.close(); err != nil {
+		return err
+	}
+	// the log is removed first, so a crash leaves only files that are ignored
+	if err := os.Remove(r.path(name) + scores.LogExt); err != nil {
+		return err
+	}
+	if err := r.removePeriods(name); err != nil {
+		return err
+	}
+	for _, ext := range []string{scores.SnapshotExt, configExt} {
+		if err := os.Remove(r.path(name) + ext); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checkpoint snapshots all boards, compacting their logs.
+//
+// It does nothing if the boards are not persisted.
+func (r *Registry) Checkpoint() error {
+	if r.dir == "" {
+		return nil
+	}
+	r.mu.Lock()
+	boards := make(map[string]*Board, len(r.boards))
+	for name, board := range r.boards {
+		boards[name] = board
+	}
+	r.mu.Unlock()
+	for name, board := range boards {
+		if err := board.checkpoint(); err != nil {
+			if _, getErr := r.Get(name); getErr != nil {
+				// the board was deleted in the meantime
+				continue
+			}
+			return fmt.Errorf("checkpoint of board %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Sweep removes the expired scores of all boards, returning their number.
+func (r *Registry) Sweep() int {
+	r.mu.Lock()
+	boards := make([]*Board, 0, len(r.boards))
+	for _, board := range r.boards {
+		boards = append(boards, board)
+	}
+	r.mu.Unlock()
+	var n int
+	for _, board := range boards {
+		n += board.sweep()
+	}
+	return n
+}
+
+// Names returns the names of all boards, sorted.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.boards))
+	for name := range r.boards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// path returns the path of the files of the board, without extension.
+func (r *Registry) path(name string) string {
+	return filepath.Join(r.dir, name)
+}
+
+// removePeriods removes the files of the scores of every period of the board.
+func (r *Registry) removePeriods(name string) error {
+	// board names do not have dots, so these are only the files of the periods and of the shards of this board
+	paths, err := filepath.Glob(r.path(name) + ".*.*")
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,595 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gadumitrachioaiei/gamescore/scores"
+)
+
+// The Redis protocol (RESP) serves the boards as sorted sets, so redis clients can use them,
+// with the commands ZADD, ZINCRBY, ZREVRANGE, ZREVRANK, ZSCORE, ZCARD and ZREM.
+//
+// The key of a sorted set is the name of a board, its members are user ids and its scores are the scores of all time.
+// Unlike redis, scores are integers and boards are not created by writing to them.
+// Reading a board that does not exist returns an empty sorted set, as reading a missing key in redis.
+
+const (
+	// respIdleTimeout is how long a connection can wait for its next command before it is closed.
+	respIdleTimeout = 5 * time.Minute
+	// respMaxArgs is the maximum number of arguments of a command.
+	respMaxArgs = 1 << 16
+	// respMaxBulk is the maximum size of an argument of a command.
+	respMaxBulk = 1 << 16
+	// respMaxInline is the maximum size of an inline command, sent as a line of text.
+	respMaxInline = 1 << 16
+	// respMinAcceptDelay is how long we wait before accepting again after the first failed accept.
+	respMinAcceptDelay = 5 * time.Millisecond
+	// respMaxAcceptDelay is the longest we wait before accepting again after failed accepts.
+	respMaxAcceptDelay = time.Second
+)
+
+// errRESPProtocol is returned for requests that do not follow the protocol, after which the connection is closed.
+var errRESPProtocol = errors.New("Protocol error")
+
+// ServeRESP serves the boards over the Redis protocol to the connections accepted by the listener,
+// until the service or the listener is closed.
+func (s *Service) ServeRESP(l net.Listener) error {
+	go func() {
+		<-s.done
+		l.Close()
+	}()
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			// as net/http, retry other errors, such as running out of file descriptors, waiting longer every time
+			if delay == 0 {
+				delay = respMinAcceptDelay
+			} else if delay *= 2; delay > respMaxAcceptDelay {
+				delay = respMaxAcceptDelay
+			}
+			log.Printf("cannot accept resp connection: %v, retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		go s.serveRESPConn(conn)
+	}
+}
+
+// serveRESPConn serves the commands of the connection, until the client or the service closes it.
+func (s *Service) serveRESPConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := respWriter{bufio.NewWriter(conn)}
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		conn.SetReadDeadline(time.Now().Add(respIdleTimeout))
+		args, err := readRESPCommand(r)
+		if err != nil {
+			if errors.Is(err, errRESPProtocol) {
+				w.fail(err.Error())
+				w.Flush()
+			} else if err != io.EOF {
+				log.Printf("cannot read resp command from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := strings.EqualFold(args[0], "QUIT")
+		if quit {
+			w.simple("OK")
+		} else {
+			s.respCommand(w, args)
+		}
+		// pipelined commands are answered together
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// readRESPCommand reads the arguments of the next command, sent either as an array of bulk strings
+// or inline, as a line of text with arguments separated by spaces.
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > respMaxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+	}
+	var args []string
+	for i := 0; i < n; i++ {
+		line, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("%w: expected '$', got '%.1s'", errRESPProtocol, line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > respMaxBulk {
+			return nil, fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+		}
+		bulk := make([]byte, size+2)
+		if _, err := io.ReadFull(r, bulk); err != nil {
+			return nil, err
+		}
+		if string(bulk[size:]) != "\r\n" {
+			return nil, fmt.Errorf("%w: expected CRLF after bulk string", errRESPProtocol)
+		}
+		args = append(args, string(bulk[:size]))
+	}
+	return args, nil
+}
+
+// readRESPLine reads a line, without its line ending.
+func readRESPLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > respMaxInline {
+			return "", fmt.Errorf("%w: too big request", errRESPProtocol)
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// respWriter writes the replies of the commands.
+type respWriter struct {
+	*bufio.Writer
+}
+
+func (w respWriter) simple(s string) {
+	fmt.Fprintf(w, "+%s\r\n", s)
+}
+
+// fail writes an error reply.
+func (w respWriter) fail(msg string) {
+	// the reply is a single line
+	msg = strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+	if !strings.HasPrefix(msg, "ERR ") {
+		msg = "ERR " + msg
+	}
+	fmt.Fprintf(w, "-%s\r\n", msg)
+}
+
+func (w respWriter) integer(n int) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+func (w respWriter) bulk(s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+// null writes the reply for a missing value.
+func (w respWriter) null() {
+	w.WriteString("$-1\r\n")
+}
+
+// array writes the header of an array reply with n elements, which must be written after it.
+func (w respWriter) array(n int) {
+	fmt.Fprintf(w, "*%d\r\n", n)
+}
+
+// respCommand describes a command.
+type respCommand struct {
+	// arity is the number of arguments, including the command name, or minus the minimum number of arguments
+	// if the command has a variable number of them.
+	arity int
+	serve func(boards *Registry, w respWriter, args []string)
+}
+
+var respCommands = map[string]respCommand{
+	"PING":      {-1, respPing},
+	"ZADD":      {-4, respZAdd},
+	"ZINCRBY":   {4, respZIncrBy},
+	"ZREVRANGE": {-4, respZRevRange},
+	"ZREVRANK":  {3, respZRevRank},
+	"ZSCORE":    {3, respZScore},
+	"ZCARD":     {2, respZCard},
+	"ZREM":      {-3, respZRem},
+}
+
+// respCommand serves the command with the given arguments, the first of them being the name of the command.
+func (s *Service) respCommand(w respWriter, args []string) {
+	cmd, ok := respCommands[strings.ToUpper(args[0])]
+	if !ok {
+		w.fail(fmt.Sprintf("unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.fail(fmt.Sprintf("wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+		return
+	}
+	cmd.serve(s.boards, w, args)
+}
+
+func respPing(boards *Registry, w respWriter, args []string) {
+	if len(args) > 1 {
+		w.bulk(args[1])
+		return
+	}
+	w.simple("PONG")
+}
+
+// respZAdd sets the scores of the members: ZADD key [NX|XX] score member [score member ...].
+//
+// It replies with the number of added members.
+func respZAdd(boards *Registry, w respWriter, args []string) {
+	var nx, xx bool
+	i := 2
+	for ; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "GT", "LT", "CH", "INCR":
+			w.fail(fmt.Sprintf("unsupported option: %s", option))
+			return
+		}
+		break
+	}
+	if nx && xx {
+		w.fail("XX and NX options at the same time are not compatible")
+		return
+	}
+	if i == len(args) || (len(args)-i)%2 != 0 {
+		w.fail("syntax error")
+		return
+	}
+	// like redis, no score is set if any of them is invalid
+	var members []scores.Score
+	for ; i < len(args); i += 2 {
+		value, err := respValue(args[i])
+		if err != nil {
+			w.fail(err.Error())
+			return
+		}
+		user, err := respUser(args[i+1])
+		if err != nil {
+			w.fail(err.Error())
+			return
+		}
+		members = append(members, scores.Score{User: user, Value: value})
+	}
+	board, err := boards.Get(args[1])
+	if err != nil {
+		w.fail(err.Error())
+		return
+	}
+	var added int
+	for _, member := range members {
+		var created bool
+		var err error
+		switch {
+		case nx:
+			created, err = board.addScore(member)
+		case xx:
+			err = board.replaceScore(member)
+		default:
+			created, err = board.setScore(member)
+		}
+		if err != nil {
+			w.fail(err.Error())
+			return
+		}
+		if created {
+			added++
+		}
+	}
+	w.integer(added)
+}
+
+// respZIncrBy increments the score of the member, adding it if it does not exist: ZINCRBY key increment member.
+//
+// It replies with the new score of the member.
+func respZIncrBy(boards *Registry, w respWriter, args []string) {
+	value, err := respValue(args[2])
+	if err != nil {
+		w.fail(err.Error())
+		return
+	}
+	user, err := respUser(args[3])
+	if err != nil {
+		w.fail(err.Error())
+		return
+	}
+	board, err := boards.Get(args[1])
+	if err != nil {
+		w.fail(err.Error())
+		return
+	}
+	sub, err := board.scores.SubmitIdempotent("", user, value, scores.Accumulate, "")
+	if err != nil {
+		w.fail(err.Error())
+		return
+	}
+	if err := board.submitPeriods("", user, value, scores.Accumulate); err != nil {
+		w.fail(err.Error())
+		return
+	}
+	w.bulk(strconv.Itoa(sub.Value))
+}
+
+// respZRevRange returns the members between the indexes start and stop, from best to worst:
+// ZREVRANGE key start stop [WITHSCORES].
+//
+// Indexes start from 0, and negative ones count from the worst member, so -1 is the worst.
+func respZRevRange(boards *Registry, w respWriter, args []string) {
+	start, err1 := strconv.Atoi(args[2])
+	stop, err2 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil {
+		w.fail("value is not an integer or out of range")
+		return
+	}
+	if len(args) > 5 || (len(args) == 5 && !strings.EqualFold(args[4], "WITHSCORES")) {
+		w.fail("syntax error")
+		return
+	}
+	withScores := len(args) == 5
+	board, ok := respBoard(boards, args[1])
+	if !ok {
+		w.array(0)
+		return
+	}
+	n := board.scores.Len()
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		w.array(0)
+		return
+	}
+	// the scores ranked between start+1 and stop+1, which are at most count around the one in the middle
+	count := (stop - start + 1) / 2
+	members := board.scores.Range(start+1+count, count)
+	if len(members) > stop-start+1 {
+		members = members[:stop-start+1]
+	}
+	if withScores {
+		w.array(2 * len(members))
+	} else {
+		w.array(len(members))
+	}
+	for _, member := range members {
+		w.bulk(strconv.Itoa(member.User))
+		if withScores {
+			w.bulk(strconv.Itoa(member.Value))
+		}
+	}
+}
+
+// respZRevRank returns the rank of the member, starting from 0 for the best: ZREVRANK key member.
+//
+// Equal scores get different ranks, in the order of the board.
+func respZRevRank(boards *Registry, w respWriter, args []string) {
+	user, err := respUser(args[2])
+	if err != nil {
+		w.fail(err.Error())
+		return
+	}
+	board, ok := respBoard(boards, args[1])
+	if !ok {
+		w.null()
+		return
+	}
+	// like the indexes of ZREVRANGE, whatever the rank mode of the board
+	position, err := board.scores.PositionOf(user)
+	if err != nil {
+		respMissing(w, err)
+		return
+	}
+	w.integer(position - 1)
+}
+
+// respZScore returns the score of the member: ZSCORE key member.
+func respZScore(boards *Registry, w respWriter, args []string) {
+	user, err := respUser(args[2])
+	if err != nil {
+		w.fail(err.Error())
+		return
+	}
+	board, ok := respBoard(boards, args[1])
+	if !ok {
+		w.null()
+		return
+	}
+	score, _, err := board.scores.Lookup(user)
+	if err != nil {
+		respMissing(w, err)
+		return
+	}
+	w.bulk(strconv.Itoa(score.Value))
+}
+
+// respZCard returns the number of members: ZCARD key.
+func respZCard(boards *Registry, w respWriter, args []string) {
+	board, ok := respBoard(boards, args[1])
+	if !ok {
+		w.integer(0)
+		return
+	}
+	w.integer(board.scores.Len())
+}
+
+// respZRem removes the members: ZREM key member [member ...].
+//
+// It replies with the number of removed members.
+func respZRem(boards *Registry, w respWriter, args []string) {
+	var users []int
+	for _, arg := range args[2:] {
+		user, err := respUser(arg)
+		if err != nil {
+			w.fail(err.Error())
+			return
+		}
+		users = append(users, user)
+	}
+	board, ok := respBoard(boards, args[1])
+	if !ok {
+		w.integer(0)
+		return
+	}
+	var removed int
+	for _, user := range users {
+		ok, err := board.removeScore(user)
+		if err != nil {
+			w.fail(err.Error())
+			return
+		}
+		if ok {
+			removed++
+		}
+	}
+	w.integer(removed)
+}
+
+// respBoard returns the board with the given name, or false if it does not exist.
+func respBoard(boards *Registry, name string) (*Board, bool) {
+	board, err := boards.Get(name)
+	if err != nil {
+		return nil, false
+	}
+	return board, true
+}
+
+// respMissing writes the reply for a member which cannot be found, or the error if it is another one.
+func respMissing(w respWriter, err error) {
+	if errors.Is(err, scores.ErrUserNotFound) {
+		w.null()
+		return
+	}
+	w.fail(err.Error())
+}
+
+// respUser returns the user id of a member.
+func respUser(member string) (int, error) {
+	user, err := strconv.Atoi(member)
+	if err != nil || user <= 0 {
+		return 0, fmt.Errorf("member is not a valid user id: %q", member)
+	}
+	return user, nil
+}
+
+// respValue returns a score, which unlike in redis must be an integer.
+func respValue(score string) (int, error) {
+	value, err := strconv.Atoi(score)
+	if err != nil {
+		return 0, errors.New("value is not an integer or out of range")
+	}
+	return value, nil
+}
+
+// setScore sets the score of the user, adding the user if it does not have a score,
+// and returns whether it was added.
+func (s *Board) setScore(score scores.Score) (bool, error) {
+	sub, err := s.scores.SubmitIdempotent("", score.User, score.Value, scores.KeepLatest, "")
+	if err != nil {
+		return false, err
+	}
+	return sub.Created, s.submitPeriods("", score.User, score.Value, scores.KeepLatest)
+}
+
+// addScore adds the score of the user, unless the user already has a score, and returns whether it was added.
+func (s *Board) addScore(score scores.Score) (bool, error) {
+	if _, _, err := s.scores.Lookup(score.User); err == nil {
+		return false, nil
+	}
+	if _, err := s.scores.Apply(scores.Mutation{Kind: scores.MutationAdd, User: score.User, Value: score.Value}); err != nil {
+		if _, _, lookupErr := s.scores.Lookup(score.User); lookupErr == nil {
+			// added in the meantime
+			return false, nil
+		}
+		return false, err
+	}
+	return true, s.submitPeriods("", score.User, score.Value, scores.Accumulate)
+}
+
+// replaceScore sets the score of the user, unless the user does not have a score.
+func (s *Board) replaceScore(score scores.Score) error {
+	for {
+		current, version, err := s.scores.Lookup(score.User)
+		if errors.Is(err, scores.ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// the version makes sure the delta is added to the score it was calculated from
+		_, err = s.scores.Apply(scores.Mutation{
+			Kind: scores.MutationUpdate, User: score.User, Value: score.Value - current.Value, Version: version,
+		})
+		if errors.Is(err, scores.ErrVersionMismatch) || errors.Is(err, scores.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return s.submitPeriods("", score.User, score.Value, scores.KeepLatest)
+	}
+}
+
+// removeScore removes the user, and returns whether it had a score.
+func (s *Board) removeScore(user int) (bool, error) {
+	if _, err := s.scores.Apply(scores.Mutation{Kind: scores.MutationRemove, User: user}); err != nil {
+		if errors.Is(err, scores.ErrUserNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	now := s.now()
+	for _, period := range s.periods {
+		if err := period.Remove("", user, now); err != nil && !errors.Is(err, scores.ErrUserNotFound) {
+			return true, err
+		}
+	}
+	return true, nil
+}
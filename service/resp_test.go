@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestReadRESPCommand tests reading commands sent as arrays of bulk strings or inline,
+// and that requests which do not follow the protocol, or are too big, are protocol errors.
+func TestReadRESPCommand(t *testing.T) {
+	testCases := []struct {
+		request  string
+		expected []string
+		err      error
+	}{
+		{"*2\r\n$4\r\nPING\r\n$5\r\nhello\r\n", []string{"PING", "hello"}, nil},
+		{"*1\r\n$0\r\n\r\n", []string{""}, nil},
+		{"*0\r\n", nil, nil},
+		// bulk strings can have spaces and line endings
+		{"*1\r\n$4\r\na\r\nb\r\n", []string{"a\r\nb"}, nil},
+		{"ZCARD  level-1\r\n", []string{"ZCARD", "level-1"}, nil},
+		{"PING\n", []string{"PING"}, nil},
+		{"\r\n", []string{}, nil},
+		{"*x\r\n", nil, errRESPProtocol},
+		{fmt.Sprintf("*%d\r\n", respMaxArgs+1), nil, errRESPProtocol},
+		{"*1\r\n:4\r\n", nil, errRESPProtocol},
+		{"*1\r\n$-1\r\n", nil, errRESPProtocol},
+		{fmt.Sprintf("*1\r\n$%d\r\n", respMaxBulk+1), nil, errRESPProtocol},
+		{"*1\r\n$2\r\nabcd\r\n", nil, errRESPProtocol},
+		{strings.Repeat("a", respMaxInline+1) + "\r\n", nil, errRESPProtocol},
+		{"*2\r\n$4\r\nPING\r\n", nil, io.EOF},
+		{"*1\r\n$4\r\nPI", nil, io.ErrUnexpectedEOF},
+	}
+	for _, tc := range testCases {
+		args, err := readRESPCommand(bufio.NewReader(strings.NewReader(tc.request)))
+		if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+			t.Fatalf("got error reading %q: %v, expected: %v", tc.request, err, tc.err)
+		}
+		if tc.err == nil && !reflect.DeepEqual(args, tc.expected) && !(len(args) == 0 && len(tc.expected) == 0) {
+			t.Fatalf("got arguments of %q: %q, expected: %q", tc.request, args, tc.expected)
+		}
+	}
+}
+
+// respClient is the client side of a connection served over the Redis protocol.
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialRESP returns a client of the service, connected over a pipe.
+func dialRESP(t *testing.T, svc *Service) *respClient {
+	client, server := net.Pipe()
+	go svc.serveRESPConn(server)
+	t.Cleanup(func() { client.Close() })
+	return &respClient{t: t, conn: client, r: bufio.NewReader(client)}
+}
+
+// send sends the commands together, as arrays of bulk strings.
+func (c *respClient) send(commands ...[]string) {
+	var request strings.Builder
+	for _, args := range commands {
+		fmt.Fprintf(&request, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := io.WriteString(c.conn, request.String()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// reply returns the next reply, as it was sent.
+func (c *respClient) reply() string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	switch line[0] {
+	case '$':
+		if n < 0 {
+			return line
+		}
+		bulk := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, bulk); err != nil {
+			c.t.Fatal(err)
+		}
+		return line + string(bulk)
+	case '*':
+		for i := 0; i < n; i++ {
+			line += c.reply()
+		}
+	}
+	return line
+}
+
+// do sends the command and returns its reply.
+func (c *respClient) do(args ...string) string {
+	c.send(args)
+	return c.reply()
+}
+
+// closed returns whether the service closed the connection.
+func (c *respClient) closed() bool {
+	_, err := c.r.ReadByte()
+	return err == io.EOF
+}
+
+// TestRESPCommands tests the replies of every command.
+func TestRESPCommands(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	if _, err := svc.Boards().Create(BoardConfig{Name: "level-1", RankMode: "dense", TieBreak: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	c := dialRESP(t, svc)
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"PING"}, "+PONG\r\n"},
+		{[]string{"ping", "hello"}, "$5\r\nhello\r\n"},
+		{[]string{"ZADD", "level-1", "10", "1", "20", "2", "20", "3"}, ":3\r\n"},
+		{[]string{"ZADD", "level-1", "NX", "5", "1", "30", "4"}, ":1\r\n"},
+		{[]string{"ZADD", "level-1", "XX", "40", "5", "15", "4"}, ":0\r\n"},
+		{[]string{"ZADD", "level-1", "NX", "XX", "1", "1"}, "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{[]string{"ZADD", "level-1", "GT", "1", "1"}, "-ERR unsupported option: GT\r\n"},
+		{[]string{"ZADD", "level-1", "1", "1", "2"}, "-ERR syntax error\r\n"},
+		{[]string{"ZADD", "level-1", "1.5", "1"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ZADD", "level-1", "1", "one"}, "-ERR member is not a valid user id: \"one\"\r\n"},
+		{[]string{"ZADD", "level-2", "1", "1"}, "-ERR board cannot be found: level-2\r\n"},
+		{[]string{"ZSCORE", "level-1", "4"}, "$2\r\n15\r\n"},
+		{[]string{"ZSCORE", "level-1", "5"}, "$-1\r\n"},
+		{[]string{"ZSCORE", "level-2", "1"}, "$-1\r\n"},
+		{[]string{"ZINCRBY", "level-1", "5", "1"}, "$2\r\n15\r\n"},
+		{[]string{"ZINCRBY", "level-1", "7", "6"}, "$1\r\n7\r\n"},
+		// equal scores get different ranks, as their indexes
+		{[]string{"ZREVRANGE", "level-1", "0", "-1", "WITHSCORES"},
+			"*10\r\n$1\r\n2\r\n$2\r\n20\r\n$1\r\n3\r\n$2\r\n20\r\n$1\r\n4\r\n$2\r\n15\r\n$1\r\n1\r\n$2\r\n15\r\n$1\r\n6\r\n$1\r\n7\r\n"},
+		{[]string{"ZREVRANGE", "level-1", "1", "2"}, "*2\r\n$1\r\n3\r\n$1\r\n4\r\n"},
+		{[]string{"ZREVRANGE", "level-1", "-2", "10"}, "*2\r\n$1\r\n1\r\n$1\r\n6\r\n"},
+		{[]string{"ZREVRANGE", "level-1", "3", "1"}, "*0\r\n"},
+		{[]string{"ZREVRANGE", "level-2", "0", "-1"}, "*0\r\n"},
+		{[]string{"ZREVRANGE", "level-1", "0", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"ZREVRANGE", "level-1", "0", "1", "SCORES"}, "-ERR syntax error\r\n"},
+		{[]string{"ZREVRANK", "level-1", "2"}, ":0\r\n"},
+		{[]string{"ZREVRANK", "level-1", "3"}, ":1\r\n"},
+		{[]string{"ZREVRANK", "level-1", "1"}, ":3\r\n"},
+		{[]string{"ZREVRANK", "level-1", "5"}, "$-1\r\n"},
+		{[]string{"ZREVRANK", "level-2", "1"}, "$-1\r\n"},
+		{[]string{"ZCARD", "level-1"}, ":5\r\n"},
+		{[]string{"ZCARD", "level-2"}, ":0\r\n"},
+		{[]string{"ZREM", "level-1", "1", "5"}, ":1\r\n"},
+		{[]string{"ZREM", "level-1", "x"}, "-ERR member is not a valid user id: \"x\"\r\n"},
+		{[]string{"ZREM", "level-2", "1"}, ":0\r\n"},
+		{[]string{"ZCARD", "level-1"}, ":4\r\n"},
+		{[]string{"ZCARD"}, "-ERR wrong number of arguments for 'zcard' command\r\n"},
+		{[]string{"ZADD", "level-1", "1"}, "-ERR wrong number of arguments for 'zadd' command\r\n"},
+		{[]string{"GET", "level-1"}, "-ERR unknown command 'GET'\r\n"},
+	}
+	for _, tc := range testCases {
+		if calculated := c.do(tc.args...); calculated != tc.expected {
+			t.Fatalf("got reply to %q: %q, expected: %q", tc.args, calculated, tc.expected)
+		}
+	}
+}
+
+// TestRESPConnection tests inline and pipelined commands, and when the connection is closed.
+func TestRESPConnection(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	c := dialRESP(t, svc)
+	if _, err := io.WriteString(c.conn, "ZCARD default\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if calculated, expected := c.reply(), ":0\r\n"; calculated != expected {
+		t.Fatalf("got reply to inline command: %q, expected: %q", calculated, expected)
+	}
+	c.send([]string{"ZADD", "default", "1", "1"}, []string{"ZADD", "default", "2", "2"}, []string{"ZCARD", "default"})
+	for _, expected := range []string{":1\r\n", ":1\r\n", ":2\r\n"} {
+		if calculated := c.reply(); calculated != expected {
+			t.Fatalf("got reply to pipelined command: %q, expected: %q", calculated, expected)
+		}
+	}
+	if calculated, expected := c.do("QUIT"), "+OK\r\n"; calculated != expected || !c.closed() {
+		t.Fatalf("got reply to quit: %q, expected: %q and the connection closed", calculated, expected)
+	}
+
+	c = dialRESP(t, svc)
+	if _, err := io.WriteString(c.conn, "*1\r\n:1\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if calculated, expected := c.reply(), "-ERR Protocol error: expected '$', got ':'\r\n"; calculated != expected || !c.closed() {
+		t.Fatalf("got reply to protocol error: %q, expected: %q and the connection closed", calculated, expected)
+	}
+}
+
+// failingListener is a listener whose accepts fail with err, a number of times, and then with net.ErrClosed.
+type failingListener struct {
+	net.Listener
+	err      error
+	failures int
+	accepts  int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.accepts++
+	if l.accepts <= l.failures {
+		return nil, l.err
+	}
+	return nil, fmt.Errorf("accept: %w", net.ErrClosed)
+}
+
+func (l *failingListener) Close() error {
+	return nil
+}
+
+// TestServeRESPAccept tests that accept errors are retried until the listener is closed.
+func TestServeRESPAccept(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	l := &failingListener{err: errors.New("too many open files"), failures: 3}
+	if err := svc.ServeRESP(l); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("got error serving a closed listener: %v, expected: %v", err, net.ErrClosed)
+	}
+	if l.accepts != l.failures+1 {
+		t.Fatalf("got %d accepts, expected: %d", l.accepts, l.failures+1)
+	}
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// connKey is the key of the connection of a request in its context.
+type connKey struct{}
+
+// Server returns an http server of the service at address.
+//
+// A request must be read and answered within timeout, except imports and exports, which stream
+// all the scores of a board and get transferTimeout instead. After that the connection is closed,
+// so a client gets an error instead of a truncated response.
+func (s *Service) Server(address string, timeout, transferTimeout time.Duration) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/scores/", s)
+	mux.Handle("/boards/", s)
+	return &http.Server{
+		Addr:              address,
+		Handler:           deadlines(mux, timeout, transferTimeout),
+		ReadHeaderTimeout: timeout,
+		IdleTimeout:       timeout,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, conn)
+		},
+	}
+}
+
+// deadlines sets the deadlines of reading and answering every request, which the server cannot do per request.
+func deadlines(h http.Handler, timeout, transferTimeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		deadline := time.Now().Add(timeout)
+		if transfer(req.URL.Path) {
+			deadline = time.Now().Add(transferTimeout)
+		}
+		if conn, ok := req.Context().Value(connKey{}).(net.Conn); ok {
+			conn.SetReadDeadline(deadline)
+			conn.SetWriteDeadline(deadline)
+		}
+		ctx, cancel := context.WithDeadline(req.Context(), deadline)
+		defer cancel()
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// transfer returns whether the path is of an import or an export of a board.
+func transfer(path string) bool {
+	if rest := strings.TrimPrefix(path, "/boards/"); rest != path {
+		if i := strings.Index(rest, "/"); i >= 0 {
+			path = rest[i:]
+		}
+	}
+	return strings.HasPrefix(path, "/scores/import") || strings.HasPrefix(path, "/scores/export")
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gadumitrachioaiei/gamescore/scores"
+)
+
+// TestServerTransfer tests that a large export is not cut by the timeout of ordinary requests,
+// while ordinary requests still have it.
+func TestServerTransfer(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	// more scores than fit in the buffers of the connection, so writing them waits for the client
+	n := 1000000
+	var i int
+	err := svc.Boards().Load(DefaultBoard, func() (scores.Score, error) {
+		if i == n {
+			return scores.Score{}, io.EOF
+		}
+		i++
+		return scores.Score{User: i, Value: n - i}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := 100 * time.Millisecond
+	url := serve(t, svc.Server("", timeout, time.Minute))
+
+	resp, err := http.Get(url + "/scores/export/?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// a slow client
+	time.Sleep(3 * timeout)
+	var lines int
+	r := bufio.NewReader(resp.Body)
+	for {
+		if _, err := r.ReadString('\n'); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("got error after %d lines: %v", lines, err)
+		}
+		lines++
+	}
+	if lines != n+1 {
+		t.Fatalf("got %d lines, expected: %d", lines, n+1)
+	}
+
+	body, w := io.Pipe()
+	go func() {
+		w.Write([]byte(`{"User": 1, `))
+		time.Sleep(3 * timeout)
+		w.Write([]byte(`"Total": 1}`))
+		w.Close()
+	}()
+	if resp, err := http.Post(url+"/boards/default/scores/", "application/json", body); err == nil && resp.StatusCode == http.StatusOK {
+		t.Fatalf("expected error for a request slower than the timeout")
+	}
+}
+
+// TestTransfer tests which paths are imports and exports.
+func TestTransfer(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"/scores/export/":              true,
+		"/scores/import":               true,
+		"/boards/a/scores/export/":     true,
+		"/boards/a/scores/import/":     true,
+		"/scores/top/":                 false,
+		"/boards/scores/export/":       false,
+		"/boards/export/scores/top/":   false,
+		"/boards/a/scores/history/":    false,
+		"/boards/scores/import/scores": false,
+	} {
+		if transfer(path) != expected {
+			t.Fatalf("got transfer %v for %s, expected: %v", !expected, path, expected)
+		}
+	}
+}
+
+// serve serves the server on a random local port until the test ends, and returns its url.
+func serve(t *testing.T, server *http.Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	return "http://" + l.Addr().String()
+}
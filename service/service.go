@@ -2,122 +2,158 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gadumitrachioaiei/gamescore/scores"
 )
 
+// Service serves our leaderboards.
+//
+// Every board is served under /boards/{name}/scores/, and the default board is also served under /scores/.
+// Boards are listed and created under /boards/, and deleted under /boards/{name}.
 type Service struct {
-	scores *scores.Scores
+	boards    *Registry
+	done      chan struct{} // closed when the service is closed
+	closeOnce sync.Once
 }
 
-func New() *Service {
-	return &Service{scores: scores.New()}
+// New returns a service that keeps the boards in memory, with the given scores for the default board.
+//
+// The scores can be any implementation of scores.Leaderboard, such as a fake one in tests.
+// If they are nil, the default board keeps its scores as by NewRegistry.
+func New(s scores.Leaderboard) *Service {
+	return &Service{boards: NewRegistry(s), done: make(chan struct{})}
 }
 
-func (s *Service) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if req.Method == http.MethodPost {
-		s.AddScore(w, req)
-		return
-	}
-	if req.Method == http.MethodPut {
-		s.UpdateScore(w, req)
-		return
-	}
-	if strings.HasPrefix(req.URL.Path, "/scores/top") {
-		s.Top(w, req)
-		return
-	}
-	if strings.HasPrefix(req.URL.Path, "/scores/range") {
-		s.Range(w, req)
-		return
+// Open returns a service that persists the boards in the directory dir, restoring the existing ones.
+func Open(dir string) (*Service, error) {
+	boards, err := OpenRegistry(dir)
+	if err != nil {
+		return nil, err
 	}
+	return &Service{boards: boards, done: make(chan struct{})}, nil
 }
 
-type Score struct {
-	User  int
-	Total int
+// Close stops the snapshots and closes the boards.
+func (s *Service) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return s.boards.Close()
 }
 
-type ScoreUpdate struct {
-	User  int
-	Score int
+// Snapshot snapshots the persisted boards every interval, until the service is closed.
+//
+// Restarting the service then loads the snapshots and replays only the mutations after them.
+func (s *Service) Snapshot(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.boards.Checkpoint(); err != nil {
+				log.Printf("cannot snapshot boards: %v", err)
+			}
+		}
+	}
 }
 
-func (s *Service) AddScore(w http.ResponseWriter, req *http.Request) {
-	var score Score
-	if err := json.NewDecoder(req.Body).Decode(&score); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	if score.User <= 0 {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
-		return
-	}
-	if err := s.scores.Add(scores.Score{User: score.User, Value: score.Total}); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// Sweep removes the expired scores of all boards every interval, until the service is closed.
+//
+// Expired scores are never returned anyway, so this only frees their memory.
+func (s *Service) Sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.boards.Sweep()
+		}
 	}
 }
 
-func (s *Service) UpdateScore(w http.ResponseWriter, req *http.Request) {
-	var score ScoreUpdate
-	if err := json.NewDecoder(req.Body).Decode(&score); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// Boards returns the registry of our boards.
+func (s *Service) Boards() *Registry {
+	return s.boards
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/boards" && !strings.HasPrefix(req.URL.Path, "/boards/") {
+		board, _ := s.boards.Get(DefaultBoard)
+		board.ServeHTTP(w, req)
 		return
 	}
-	if score.User <= 0 {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+	name := strings.Trim(strings.TrimPrefix(req.URL.Path, "/boards"), "/")
+	if name == "" {
+		if req.Method == http.MethodPost {
+			s.CreateBoard(w, req)
+			return
+		}
+		s.ListBoards(w, req)
 		return
 	}
-	newScore, err := s.scores.Update(scores.Score{User: score.User, Value: score.Score})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if i := strings.Index(name, "/"); i > 0 {
+		name = name[:i]
+		board, err := s.boards.Get(name)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		http.StripPrefix("/boards/"+name, board).ServeHTTP(w, req)
 		return
 	}
-	if err := json.NewEncoder(w).Encode(Score{User: score.User, Total: newScore.Value}); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	if req.Method == http.MethodDelete {
+		s.DeleteBoard(w, req, name)
 		return
 	}
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
-func (s *Service) Top(w http.ResponseWriter, req *http.Request) {
-	if err := req.ParseForm(); err != nil {
+func (s *Service) CreateBoard(w http.ResponseWriter, req *http.Request) {
+	var config BoardConfig
+	if err := json.NewDecoder(req.Body).Decode(&config); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	top, err := strconv.Atoi(req.Form.Get("top"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if _, err := s.boards.Create(config); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
-	topScores := s.scores.Top(int(top))
-	if err := json.NewEncoder(w).Encode(topScores); err != nil {
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Service) ListBoards(w http.ResponseWriter, req *http.Request) {
+	if err := json.NewEncoder(w).Encode(s.boards.Names()); err != nil {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 }
 
-func (s *Service) Range(w http.ResponseWriter, req *http.Request) {
-	if err := req.ParseForm(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	position, err := strconv.Atoi(req.Form.Get("position"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	count, err := strconv.Atoi(req.Form.Get("count"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	topScores := s.scores.Range(position, count)
-	if err := json.NewEncoder(w).Encode(topScores); err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+func (s *Service) DeleteBoard(w http.ResponseWriter, req *http.Request, name string) {
+	if err := s.boards.Delete(name); err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 }
+
+// errorStatus returns the http status for an error returned by the scores or the boards.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, scores.ErrUserNotFound), errors.Is(err, ErrBoardNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrBoardExists), errors.Is(err, scores.ErrVersionMismatch):
+		return http.StatusConflict
+	case errors.Is(err, scores.ErrLogFailed):
+		return http.StatusInternalServerError
+	case errors.Is(err, scores.ErrClosed):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
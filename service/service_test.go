@@ -0,0 +1,397 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gadumitrachioaiei/gamescore/scores"
+)
+
+// fakeScores is a scores.Leaderboard with only the methods of the interface, ranking equal scores by user id.
+type fakeScores struct {
+	mu       sync.Mutex
+	users    map[int]scores.VersionedScore
+	versions uint64
+}
+
+var _ scores.Leaderboard = (*fakeScores)(nil)
+
+func newFakeScores() *fakeScores {
+	return &fakeScores{users: make(map[int]scores.VersionedScore)}
+}
+
+func (f *fakeScores) Add(score scores.Score) error {
+	_, err := f.Apply(scores.Mutation{Kind: scores.MutationAdd, User: score.User, Value: score.Value})
+	return err
+}
+
+func (f *fakeScores) Update(score scores.Score) (scores.Score, error) {
+	v, err := f.Apply(scores.Mutation{Kind: scores.MutationUpdate, User: score.User, Value: score.Value})
+	return v.Score, err
+}
+
+func (f *fakeScores) Remove(user int) error {
+	_, err := f.Apply(scores.Mutation{Kind: scores.MutationRemove, User: user})
+	return err
+}
+
+func (f *fakeScores) Apply(m scores.Mutation) (scores.VersionedScore, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	current, ok := f.users[m.User]
+	if m.Kind == scores.MutationAdd {
+		if ok {
+			return scores.VersionedScore{}, fmt.Errorf("Existing user: %d", m.User)
+		}
+		return f.set(scores.Score{User: m.User, Value: m.Value}), nil
+	}
+	if !ok {
+		return scores.VersionedScore{}, fmt.Errorf("%w: %d", scores.ErrUserNotFound, m.User)
+	}
+	if m.Version != 0 && m.Version != current.Version {
+		return scores.VersionedScore{}, fmt.Errorf("%w: %d", scores.ErrVersionMismatch, m.User)
+	}
+	if m.Kind == scores.MutationRemove {
+		delete(f.users, m.User)
+		return scores.VersionedScore{Score: scores.Score{User: m.User}}, nil
+	}
+	return f.set(scores.Score{User: m.User, Value: current.Value + m.Value}), nil
+}
+
+func (f *fakeScores) SubmitIdempotent(key string, user int, value int, policy scores.SubmitPolicy, reason string) (scores.Submission, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sub := scores.Submission{PreviousRank: f.position(user)}
+	current, ok := f.users[user]
+	sub.Created = !ok
+	switch {
+	case !ok, policy == scores.KeepLatest, policy == scores.KeepBest && value > current.Value:
+		current = f.set(scores.Score{User: user, Value: value})
+	case policy == scores.Accumulate:
+		current = f.set(scores.Score{User: user, Value: current.Value + value})
+	}
+	sub.Score, sub.Version, sub.Rank = current.Score, current.Version, f.position(user)
+	return sub, nil
+}
+
+func (f *fakeScores) Top(top int) []scores.Score {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sorted := f.sorted()
+	return sorted[:min(max(top, 0), len(sorted))]
+}
+
+func (f *fakeScores) TopRanked(top int, mode scores.RankMode) []scores.RankedScore {
+	return ranked(f.Top(top), 1)
+}
+
+func (f *fakeScores) Range(position int, count int) []scores.Score {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sorted := f.sorted()
+	start, end := max(position-count, 1), min(position+count, len(sorted))
+	if start > end {
+		return nil
+	}
+	return sorted[start-1 : end]
+}
+
+func (f *fakeScores) RangeRanked(position int, count int, mode scores.RankMode) []scores.RankedScore {
+	return ranked(f.Range(position, count), max(position-count, 1))
+}
+
+func (f *fakeScores) RankOf(user int) (int, scores.Score, error) {
+	score, _, err := f.Lookup(user)
+	return score.Rank, score.Score, err
+}
+
+func (f *fakeScores) PositionOf(user int) (int, error) {
+	rank, _, err := f.RankOf(user)
+	return rank, err
+}
+
+func (f *fakeScores) Lookup(user int) (scores.RankedScore, uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	current, ok := f.users[user]
+	if !ok {
+		return scores.RankedScore{}, 0, fmt.Errorf("%w: %d", scores.ErrUserNotFound, user)
+	}
+	return scores.RankedScore{Score: current.Score, Rank: f.position(user)}, current.Version, nil
+}
+
+func (f *fakeScores) AroundUser(user int, count int) ([]scores.RankedScore, error) {
+	rank, _, err := f.RankOf(user)
+	if err != nil {
+		return nil, err
+	}
+	return f.RangeRanked(rank, count, scores.OrdinalRank), nil
+}
+
+func (f *fakeScores) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.users)
+}
+
+func (f *fakeScores) RankMode() scores.RankMode {
+	return scores.OrdinalRank
+}
+
+// set sets the score of the user, with a new version.
+func (f *fakeScores) set(score scores.Score) scores.VersionedScore {
+	f.versions++
+	f.users[score.User] = scores.VersionedScore{Score: score, Version: f.versions}
+	return f.users[score.User]
+}
+
+// sorted returns the scores from best to worst.
+func (f *fakeScores) sorted() []scores.Score {
+	var sorted []scores.Score
+	for _, v := range f.users {
+		sorted = append(sorted, v.Score)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Value != sorted[j].Value {
+			return sorted[i].Value > sorted[j].Value
+		}
+		return sorted[i].User < sorted[j].User
+	})
+	return sorted
+}
+
+// position returns the rank of the user, or 0 if it does not have a score.
+func (f *fakeScores) position(user int) int {
+	for i, score := range f.sorted() {
+		if score.User == user {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ranked returns the scores with ordinal ranks, starting from rank.
+func ranked(scoreList []scores.Score, rank int) []scores.RankedScore {
+	result := make([]scores.RankedScore, len(scoreList))
+	for i, score := range scoreList {
+		result[i] = scores.RankedScore{Score: score, Rank: rank + i}
+	}
+	return result
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// request is a request to the service, with the status and body expected in its response.
+//
+// If the body ends with "*", the response body must only start with it.
+type request struct {
+	method, url, body string
+	header            http.Header
+	status            int
+	expected          string
+}
+
+// serveRequests serves the requests in order, failing the test at the first unexpected response.
+func serveRequests(t *testing.T, h http.Handler, requests []request) {
+	t.Helper()
+	for _, r := range requests {
+		w := serveRequest(h, r)
+		body := strings.TrimSuffix(w.Body.String(), "\n")
+		ok := body == r.expected
+		if prefix := strings.TrimSuffix(r.expected, "*"); prefix != r.expected {
+			ok = strings.HasPrefix(body, prefix)
+		}
+		if w.Code != r.status || !ok {
+			t.Fatalf("got response to %s %s: %d %q, expected: %d %q", r.method, r.url, w.Code, body, r.status, r.expected)
+		}
+	}
+}
+
+// serveRequest serves the request, returning its response.
+func serveRequest(h http.Handler, r request) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(r.method, r.url, strings.NewReader(r.body))
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// ifMatch returns the header of a request expecting the given version.
+func ifMatch(version string) http.Header {
+	return http.Header{"If-Match": {version}}
+}
+
+// TestServiceFakeScores tests the requests of a board, and their errors, on scores which have only
+// the methods of scores.Leaderboard, so the requests which need other methods are not implemented.
+func TestServiceFakeScores(t *testing.T) {
+	svc := New(newFakeScores())
+	defer svc.Close()
+	serveRequests(t, svc, []request{
+		{"POST", "/scores/", `{"user": 1, "total": 10}`, nil, 200, `{"User":1,"Total":10,"Reason":"","Version":1}`},
+		{"POST", "/scores/", `{"user": 1, "total": 10}`, nil, 400, "Existing user: 1"},
+		{"POST", "/scores/", `{"user": 0, "total": 10}`, nil, 400, "Invalid user id"},
+		{"POST", "/scores/", `{"user": 1,`, nil, 400, "unexpected EOF"},
+		{"PUT", "/scores/", `{"user": 1, "score": 5}`, nil, 200, `{"User":1,"Total":15,"Reason":"","Version":2}`},
+		{"PUT", "/scores/", `{"user": 9, "score": 5}`, nil, 404, "user cannot be found: 9"},
+		{"PUT", "/scores/", `{"user": 1, "score": 5, "version": 1}`, nil, 409, "*"},
+		{"PUT", "/scores/", `{"user": 1, "score": 5}`, ifMatch(`"1"`), 409, "*"},
+		{"PUT", "/scores/", `{"user": 1, "score": 1}`, ifMatch(`"2"`), 200, `{"User":1,"Total":16,"Reason":"","Version":3}`},
+		{"PUT", "/scores/", `{"user": 1, "score": 1}`, ifMatch(`"x"`), 400, `invalid If-Match header: "\"x\""`},
+		{"POST", "/scores/submit/", `{"user": 2, "value": 20}`, nil, 200,
+			`{"User":2,"Total":20,"Rank":1,"PreviousRank":0,"RankChanged":true,"Created":true,"Version":4}`},
+		{"POST", "/scores/submit/", `{"user": 2, "value": 30, "policy": "worst"}`, nil, 400, "*"},
+		{"GET", "/scores/submit/", "", nil, 405, "Method not allowed"},
+		{"GET", "/scores/top/?top=10", "", nil, 200, `[{"User":2,"Value":20,"Rank":1},{"User":1,"Value":16,"Rank":2}]`},
+		{"GET", "/scores/top/?top=x", "", nil, 400, "*"},
+		{"GET", "/scores/top/?top=10&mode=best", "", nil, 400, `unknown rank mode: "best"`},
+		{"GET", "/scores/top/?top=10&period=weekly", "", nil, 400, "board does not have weekly scores"},
+		{"GET", "/scores/top/?top=10&offset=-1", "", nil, 400, "all time scores do not have an offset"},
+		{"GET", "/scores/range/?position=2&count=1", "", nil, 200, `[{"User":2,"Value":20,"Rank":1},{"User":1,"Value":16,"Rank":2}]`},
+		{"GET", "/scores/range/?position=2", "", nil, 400, "*"},
+		{"GET", "/scores/rank/?user=1", "", nil, 200, `{"User":1,"Total":16,"Rank":2,"Players":2,"Version":3}`},
+		{"GET", "/scores/rank/?user=9", "", nil, 404, "user cannot be found: 9"},
+		{"GET", "/scores/around/?user=2&count=1", "", nil, 200, `[{"User":2,"Value":20,"Rank":1},{"User":1,"Value":16,"Rank":2}]`},
+		{"GET", "/scores/around/?user=9&count=1", "", nil, 404, "user cannot be found: 9"},
+		// invalid batches are rejected before needing the scores
+		{"POST", "/scores/batch/", `[{"op": "remove", "user": 1}]`, nil, 400, `[{"Index":0,"Error":"unknown operation: \"remove\""}]`},
+		{"POST", "/scores/batch/", `[]`, nil, 400, "Invalid batch size"},
+		{"POST", "/scores/batch/", `[{"op": "add", "user": 3, "value": 1}]`, nil, 501, "Batches are not supported by the board"},
+		{"POST", "/scores/import/?format=csv", "3,1\n", nil, 501, "Importing is not supported by the board"},
+		{"GET", "/scores/export/?format=csv", "", nil, 501, "Exporting is not supported by the board"},
+		{"GET", "/scores/history/?user=1", "", nil, 501, "History is not supported by the board"},
+		{"GET", "/scores/page/?limit=10", "", nil, 501, "Pages are not supported by the board"},
+		{"DELETE", "/scores/?user=1&erase=true", "", nil, 501, "Erasing users is not supported by the board"},
+		{"DELETE", "/scores/?user=9", "", nil, 404, "user cannot be found: 9"},
+		{"DELETE", "/scores/?user=x", "", nil, 400, "*"},
+		{"DELETE", "/scores/?user=1", "", ifMatch(`"2"`), 409, "*"},
+		{"DELETE", "/scores/?user=1", "", ifMatch(`"3"`), 200, ""},
+		{"GET", "/scores/rank/?user=1", "", nil, 404, "user cannot be found: 1"},
+		{"GET", "/scores/top/?top=10", "", nil, 200, `[{"User":2,"Value":20,"Rank":1}]`},
+	})
+}
+
+// TestServiceBoards tests creating, listing and deleting boards, and that requests go to the board in their path.
+func TestServiceBoards(t *testing.T) {
+	svc := New(nil)
+	defer svc.Close()
+	serveRequests(t, svc, []request{
+		{"GET", "/boards/", "", nil, 200, `["default"]`},
+		{"POST", "/boards/", `{"name": "level-1"}`, nil, 201, ""},
+		{"POST", "/boards/", `{"name": "level-1"}`, nil, 409, "existing board: level-1"},
+		{"POST", "/boards/", `{"name": "level 2"}`, nil, 400, `invalid board name: "level 2"`},
+		{"POST", "/boards/", `{"name": "level-2", "order": "up"}`, nil, 400, "*"},
+		{"POST", "/boards/", `{"name": "level-2", "periods": ["yearly"]}`, nil, 400, "*"},
+		{"POST", "/boards/", `{"name": "level-2", "shards": 1000}`, nil, 400, "invalid number of shards: 1000"},
+		{"POST", "/boards/", `{"name": "level-2", "retention": -1}`, nil, 400, "invalid retention: -1"},
+		{"POST", "/boards/", `{"name": "level-2", "order": "asc"}`, nil, 201, ""},
+		{"GET", "/boards", "", nil, 200, `["default","level-1","level-2"]`},
+		{"POST", "/boards/level-1/scores/", `{"user": 1, "total": 10}`, nil, 200, "*"},
+		{"POST", "/boards/level-1/scores/", `{"user": 2, "total": 20}`, nil, 200, "*"},
+		{"POST", "/boards/level-2/scores/", `{"user": 1, "total": 10}`, nil, 200, "*"},
+		{"POST", "/boards/level-2/scores/", `{"user": 2, "total": 20}`, nil, 200, "*"},
+		{"GET", "/boards/level-1/scores/top/?top=10", "", nil, 200, `[{"User":2,"Value":20,"Rank":1},{"User":1,"Value":10,"Rank":2}]`},
+		{"GET", "/boards/level-2/scores/top/?top=10", "", nil, 200, `[{"User":1,"Value":10,"Rank":1},{"User":2,"Value":20,"Rank":2}]`},
+		{"GET", "/scores/top/?top=10", "", nil, 200, "null"},
+		{"GET", "/boards/default/scores/top/?top=10", "", nil, 200, "null"},
+		{"GET", "/boards/level-3/scores/top/?top=10", "", nil, 404, "board cannot be found: level-3"},
+		{"GET", "/boards/level-1", "", nil, 405, "Method not allowed"},
+		{"DELETE", "/boards/level-1", "", nil, 200, ""},
+		{"DELETE", "/boards/level-1", "", nil, 404, "board cannot be found: level-1"},
+		{"DELETE", "/boards/default", "", nil, 400, "cannot delete the default board"},
+		{"GET", "/boards/level-1/scores/top/?top=10", "", nil, 404, "board cannot be found: level-1"},
+		// a board created again with the name of a deleted one is empty
+		{"POST", "/boards/", `{"name": "level-1"}`, nil, 201, ""},
+		{"GET", "/boards/level-1/scores/top/?top=10", "", nil, 200, "null"},
+	})
+}
+
+// TestServiceReopen tests that the boards of a persisted service, with their config and scores,
+// are restored after reopening it, except the deleted ones.
+func TestServiceReopen(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	svc, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.boards.now = clock
+	serveRequests(t, svc, []request{
+		{"POST", "/boards/", `{"name": "level-1", "order": "asc", "periods": ["daily"]}`, nil, 201, ""},
+		{"POST", "/boards/", `{"name": "level-2"}`, nil, 201, ""},
+		{"POST", "/boards/level-1/scores/", `{"user": 1, "total": 10}`, nil, 200, "*"},
+		{"POST", "/boards/level-1/scores/", `{"user": 2, "total": 20}`, nil, 200, "*"},
+		{"POST", "/scores/", `{"user": 3, "total": 30}`, nil, 200, "*"},
+		{"DELETE", "/boards/level-2", "", nil, 200, ""},
+	})
+	if err := svc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if svc, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Close()
+	svc.boards.now = clock
+	serveRequests(t, svc, []request{
+		{"GET", "/boards/", "", nil, 200, `["default","level-1"]`},
+		{"GET", "/boards/level-1/scores/top/?top=10", "", nil, 200, `[{"User":1,"Value":10,"Rank":1},{"User":2,"Value":20,"Rank":2}]`},
+		{"GET", "/boards/level-1/scores/top/?top=10&period=daily", "", nil, 200, `[{"User":1,"Value":10,"Rank":1},{"User":2,"Value":20,"Rank":2}]`},
+		{"GET", "/scores/top/?top=10", "", nil, 200, `[{"User":3,"Value":30,"Rank":1}]`},
+		{"GET", "/boards/level-2/scores/top/?top=10", "", nil, 404, "board cannot be found: level-2"},
+	})
+	now = now.Add(24 * time.Hour)
+	serveRequests(t, svc, []request{
+		{"GET", "/boards/level-1/scores/top/?top=10&period=daily", "", nil, 200, "null"},
+		{"GET", "/boards/level-1/scores/top/?top=10&period=daily&offset=-1", "", nil, 200, `[{"User":1,"Value":10,"Rank":1},{"User":2,"Value":20,"Rank":2}]`},
+	})
+}
+
+// TestServiceErrorStatus tests the status of the errors of the scores and the boards.
+func TestServiceErrorStatus(t *testing.T) {
+	testCases := []struct {
+		err    error
+		status int
+	}{
+		{fmt.Errorf("%w: 1", scores.ErrUserNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: level-1", ErrBoardNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: level-1", ErrBoardExists), http.StatusConflict},
+		{fmt.Errorf("%w: 1", scores.ErrVersionMismatch), http.StatusConflict},
+		{fmt.Errorf("%w: disk full", scores.ErrLogFailed), http.StatusInternalServerError},
+		{scores.ErrClosed, http.StatusServiceUnavailable},
+		{fmt.Errorf("invalid"), http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		if calculated := errorStatus(tc.err); calculated != tc.status {
+			t.Fatalf("got status of %v: %d, expected: %d", tc.err, calculated, tc.status)
+		}
+	}
+}
+
+// decode decodes the json body of a response into v.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("cannot decode response %q: %v", w.Body.String(), err)
+	}
+}